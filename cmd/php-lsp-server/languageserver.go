@@ -2,144 +2,118 @@ package main
 
 import (
 	"ahmedash95/php-lsp-server/pkg/logger"
-	"ahmedash95/php-lsp-server/pkg/lsp"
-	"ahmedash95/php-lsp-server/pkg/rpc"
-	"ahmedash95/php-lsp-server/pkg/workspace"
-	"bufio"
-	"encoding/json"
+	"ahmedash95/php-lsp-server/pkg/server"
+	"flag"
 	"fmt"
-	"io"
+	"net"
 	"os"
-	"runtime/debug"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 func main() {
-	fmt.Println("Starting PHP LSP Server")
-
-	l := logger.CreateLogFile("/tmp/php-lsp-server.log")
-	l.Println("Starting PHP LSP Server")
-
-	logger.SetLogger(l)
-
-	workspace := workspace.NewWorkspace("")
-
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Split(rpc.Split)
-
-	for scanner.Scan() {
-		msg := scanner.Bytes()
-
-		// Using a deferred function to recover from panics within this iteration of the loop
-		defer func() {
-			if r := recover(); r != nil {
-				l.Printf("Recovered in f: %v\n", r)
-				// Print the stack trace
-				l.Println("stacktrace from panic: \n" + string(debug.Stack()))
-			}
-		}()
-
-		// logger.GetLogger().Printf("Recived request: [%s]", msg)
-		method, contents, err := rpc.DecodeMessage(msg)
-		if err != nil {
-			l.Println("Error decoding message: ", err)
-			continue
+	stdio := flag.Bool("stdio", false, "communicate over stdin and stdout (default)")
+	listen := flag.String("listen", "", "listen for clients on a TCP address, eg. tcp://127.0.0.1:9000")
+	socket := flag.String("socket", "", "listen for clients on a unix socket path")
+	pipe := flag.String("pipe", "", "connect to the pipe or unix socket created by the client")
+	logFile := flag.String("log-file", "", "write logs to this file (default "+logger.DefaultPath()+")")
+	logLevel := flag.String("log-level", "info", "log level: error, warn, info or debug")
+	logMaxSize := flag.Int64("log-max-size", 10, "rotate the log file once it is bigger than this many megabytes, 0 disables rotation")
+	flag.Parse()
+
+	modes := 0
+	for _, set := range []bool{*stdio, *listen != "", *socket != "", *pipe != ""} {
+		if set {
+			modes++
 		}
-
-		handleMessage(os.Stdout, workspace, method, contents)
 	}
-}
-
-func handleMessage(writer io.Writer, workspace *workspace.Workspace, method string, contents []byte) {
-	logger := logger.GetLogger()
-	logger.Printf("Recived message: [%s]", method)
-
-	if method != "initialize" && workspace == nil {
-		logger.Println("Error: Initialize request must be sent first before any other request")
-		return
+	if modes > 1 {
+		fmt.Fprintln(os.Stderr, "only one of --stdio, --listen, --socket and --pipe can be used")
+		os.Exit(2)
 	}
 
-	switch method {
-	case "initialize":
-		var request lsp.InitializeRequest
-		if err := json.Unmarshal(contents, &request); err != nil {
-			logger.Println("Error unmarshalling initialize request: ", err)
-			return
-		}
-
-		logger.Printf("Initializing workspace: %s", request.Params.RootPath)
-		workspace.RootPath = request.Params.RootPath
-
-		message := lsp.NewInitializeResponse(request.ID)
-		writeResponse(writer, message)
+	level, err := logger.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-		progressStartRequest := lsp.CreateProgressBeginRequest("indexing", "Indexing workspace")
-		writeResponse(writer, progressStartRequest)
+	err = logger.Setup(logger.Options{
+		Path:       *logFile,
+		Level:      level,
+		MaxSize:    *logMaxSize * 1024 * 1024,
+		MaxBackups: 3,
+	})
+	if err != nil {
+		// keep going, logs are written to stderr instead
+		fmt.Fprintln(os.Stderr, "Error opening log file:", err)
+	}
 
-		update := func(path string, percent int) {
-			logger.Printf("Indexing file: %s", path)
-			progressUpdateRequest := lsp.CreateProgressUpdateRequest(progressStartRequest.Params.Token, "", percent)
-			writeResponse(writer, progressUpdateRequest)
-		}
-		workspace.StartIndex(update, func() {
-			progressEndRequest := lsp.CreateProgressEndRequest(progressStartRequest.Params.Token, "Indexing complete")
-			writeResponse(writer, progressEndRequest)
-		})
-	case "textDocument/didOpen":
-		var request lsp.DidOpenTextDocumentNotification
-		if err := json.Unmarshal(contents, &request); err != nil {
-			logger.Println("Error unmarshalling didOpen request: ", err)
-			return
+	logger.Infof("Starting PHP LSP Server")
+
+	switch {
+	case *listen != "":
+		err = serveTCP(*listen)
+	case *socket != "":
+		err = serveUnix(*socket)
+	case *pipe != "":
+		var conn net.Conn
+		if conn, err = net.Dial("unix", *pipe); err == nil {
+			os.Exit(server.ServeConn(conn))
 		}
+	default:
+		// stdout carries the protocol, nothing else may be written to it
+		os.Exit(server.NewServer(os.Stdout).Serve(os.Stdin))
+	}
 
-		workspace.Put(request.Params.TextDocument.Uri, request.Params.TextDocument.Text)
-		logger.Printf("Opened file: %s", request.Params.TextDocument.Uri)
+	if err != nil {
+		logger.Errorf("Error: %s", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-	case "textDocument/didChange":
-		var request lsp.DidChangeTextDocumentNotification
-		if err := json.Unmarshal(contents, &request); err != nil {
-			logger.Println("Error unmarshalling didChange request: ", err)
-			return
-		}
+func serveTCP(address string) error {
+	address = strings.TrimPrefix(address, "tcp://")
 
-		workspace.Update(request.Params.TextDocument.Uri, request.Params.ContentChanges)
-		logger.Printf("Changed file: %s", request.Params.TextDocument.Uri)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
 
-	case "textDocument/documentSymbol":
-		var request lsp.DocumentSymbolRequest
-		if err := json.Unmarshal(contents, &request); err != nil {
-			logger.Println("Error unmarshalling documentSymbol request: ", err)
-			return
-		}
+	logger.Infof("Listening on tcp://%s", listener.Addr())
+	closeOnSignal(listener)
 
-		response := workspace.TextDocumentDocumentSymbols(request.ID, request.Params.TextDocument.Uri)
-		writeResponse(writer, response)
-	case "workspace/symbol":
-		var request lsp.WorkspaceSymbolRequest
-		if err := json.Unmarshal(contents, &request); err != nil {
-			logger.Println("Error unmarshalling workspaceSymbol request: ", err)
-			return
-		}
+	return server.ServeListener(listener)
+}
 
-		response := workspace.WorkspaceSymbols(request.ID, request.Params.Query)
-		writeResponse(writer, response)
+func serveUnix(path string) error {
+	// a socket left behind by a previous run would make listen fail
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
 
-		logger.Printf("Returning workspace symbols response: %v", response)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
 
-	case "textDocument/completion":
-		var request lsp.CompletionRequest
-		if err := json.Unmarshal(contents, &request); err != nil {
-			logger.Println("Error unmarshalling completion request: ", err)
-			return
-		}
+	logger.Infof("Listening on unix://%s", path)
+	closeOnSignal(listener)
 
-		response := workspace.TextDocumentCompletion(request.ID, request.Params.TextDocumentPositionParams)
-		writeResponse(writer, response)
-	}
+	return server.ServeListener(listener)
 }
 
-func writeResponse(writer io.Writer, message any) {
-	reply := rpc.EncodeMessage(message)
-	writer.Write([]byte(reply))
+// closeOnSignal closes the listener when the process is interrupted so the
+// accept loop returns and cleanup runs.
+func closeOnSignal(listener net.Listener) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-	logger.GetLogger().Printf("Sending response: [%s]", reply)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
 }
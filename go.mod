@@ -4,4 +4,4 @@ go 1.19
 
 require github.com/smacker/go-tree-sitter v0.0.0-20240510005643-04d6b33fe138
 
-require github.com/sahilm/fuzzy v0.1.1 // indirect
+require github.com/sahilm/fuzzy v0.1.1
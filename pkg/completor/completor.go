@@ -3,14 +3,19 @@ package completor
 import (
 	"ahmedash95/php-lsp-server/pkg/logger"
 	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/symboltable"
 	"ahmedash95/php-lsp-server/pkg/treesitter"
 
+	"strings"
+
 	sitter "github.com/smacker/go-tree-sitter"
 )
 
 type Match struct {
 	Text string
 	Kind int
+	// Declaration is the source line declaring the completed symbol, if any.
+	Declaration string
 }
 
 type CompletorInterface interface {
@@ -22,25 +27,28 @@ type Completor struct {
 	registers []CompletorInterface
 }
 
-func NewCompletor() Completor {
+// NewCompletor returns the completors of a document, symbols resolves the
+// classes it refers to.
+func NewCompletor(symbols *symboltable.Table) Completor {
 	return Completor{
 		registers: []CompletorInterface{
 			&VariablesCompletor{},
 			&ObjectAccessing{},
-			&InstanceAccess{},
+			&InstanceAccess{Symbols: symbols},
 		},
 	}
 }
 
 func (c *Completor) GetCompletions(doc *treesitter.TextDocumentItem, pos lsp.Position) []Match {
-	node := treesitter.GetNodeAtPosition(doc.Text, pos)
-	if node == nil {
-		logger.GetLogger().Printf("No node found at position: %v", pos)
-		panic("No node found at position")
+	tree := documentTree(doc)
+	if tree == nil {
+		return nil
 	}
 
-	if len(c.registers) == 0 {
-		panic("No completor registered")
+	node := treesitter.NodeAt(doc.Text, tree.RootNode(), pos)
+	if node == nil {
+		logger.Debugf("No node found at position: %v", pos)
+		return nil
 	}
 
 	var matches []Match
@@ -52,3 +60,46 @@ func (c *Completor) GetCompletions(doc *treesitter.TextDocumentItem, pos lsp.Pos
 
 	return matches
 }
+
+// documentTree returns a copy of the tree of doc, which other requests may
+// be reading, or parses doc when it has none.
+func documentTree(doc *treesitter.TextDocumentItem) *sitter.Tree {
+	if doc.Tree != nil {
+		return doc.Tree.Copy()
+	}
+
+	tree, err := treesitter.ParseDocument(doc.Text)
+	if err != nil {
+		logger.Debugf("Failed to parse document %s: %s", doc.Uri, err)
+		return nil
+	}
+
+	return tree
+}
+
+// rootOf returns the root of the tree of node, completors use the tree the
+// completed node was found in rather than parsing the document again.
+func rootOf(node *sitter.Node) *sitter.Node {
+	for parent := node.Parent(); parent != nil; parent = node.Parent() {
+		node = parent
+	}
+
+	return node
+}
+
+// declaration returns the line declaring symbol, without the body that may
+// start on the same line.
+func declaration(doc *treesitter.TextDocumentItem, symbol lsp.DocumentSymbol) string {
+	return declarationAt(doc, symbol.SelectionRange.Start.Line)
+}
+
+func declarationAt(doc *treesitter.TextDocumentItem, row int) string {
+	if doc.Lines == nil {
+		return ""
+	}
+
+	line, _, _ := strings.Cut(doc.Lines.Line(row), "{")
+	line = strings.TrimSpace(line)
+
+	return strings.TrimSpace(strings.TrimSuffix(line, ";"))
+}
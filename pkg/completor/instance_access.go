@@ -3,12 +3,17 @@ package completor
 import (
 	"ahmedash95/php-lsp-server/pkg/logger"
 	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/symboltable"
 	"ahmedash95/php-lsp-server/pkg/treesitter"
 
 	sitter "github.com/smacker/go-tree-sitter"
 )
 
-type InstanceAccess struct{}
+type InstanceAccess struct {
+	// Symbols resolves the classes declared by other files, nil to only
+	// look in the completed document.
+	Symbols *symboltable.Table
+}
 
 func (com *InstanceAccess) CanComplete(doc *treesitter.TextDocumentItem, node *sitter.Node) bool {
 	firstNamedChild := node.Parent().NamedChild(0)
@@ -18,7 +23,7 @@ func (com *InstanceAccess) CanComplete(doc *treesitter.TextDocumentItem, node *s
 
 	firstNamedChildIsThis := treesitter.GetNodeText(doc.Text, firstNamedChild) != "$this"
 
-	logger.GetLogger().Printf("Named Child content: %s", treesitter.GetNodeText(doc.Text, firstNamedChild))
+	logger.Debugf("Named Child content: %s", treesitter.GetNodeText(doc.Text, firstNamedChild))
 
 	if node.Type() == "name" && node.Parent().Type() == "member_access_expression" && firstNamedChildIsThis {
 		return true
@@ -31,43 +36,96 @@ func (com *InstanceAccess) Complete(doc *treesitter.TextDocumentItem, node *sitt
 	// we need to first find the object name
 	name := com.findObjectName(doc, node)
 	if name == "" {
-		logger.GetLogger().Printf("Failed to extract object name")
+		logger.Debugf("Failed to extract object name")
 		return []Match{}
 	}
 	// then find the class of that object
-	className := com.findClassName(doc, name)
+	className := com.findClassName(doc, rootOf(node), name)
 	if className == "" {
-		logger.GetLogger().Printf("Failed to extract class name for object: %s", name)
+		logger.Debugf("Failed to extract class name for object: %s", name)
+		return []Match{}
 	}
-	// then find in doc symbols the class and get all properties and methods
-	var classNode *lsp.DocumentSymbol
-	for _, symbol := range doc.DocumentSymbols {
-		if symbol.Name == className && symbol.Kind == treesitter.Kind_Class {
-			classNode = &symbol
-			break
-		}
+
+	// the class is resolved by its fully qualified name through the use
+	// statements of the document
+	if matches, ok := com.completeFromTable(doc, node, className); ok {
+		return matches
 	}
 
+	// then find in doc symbols the class and get all properties and methods
+	classNode := findClass(doc.DocumentSymbols, className)
+
 	if classNode == nil {
-		logger.GetLogger().Printf("Failed to find class node for class: %s", className)
+		logger.Debugf("Failed to find class node for class: %s", className)
 		return []Match{}
 	}
 
 	var matches []Match
-	com.findInSymbols(&matches, classNode.Children)
+	com.findInSymbols(doc, &matches, classNode.Children)
 	return matches
 }
 
-func (com *InstanceAccess) findInSymbols(matches *[]Match, symbols []lsp.DocumentSymbol) {
+func (com *InstanceAccess) completeFromTable(doc *treesitter.TextDocumentItem, node *sitter.Node, className string) ([]Match, bool) {
+	if com.Symbols == nil {
+		return nil, false
+	}
+
+	imports := treesitter.GetImports(doc.Text, rootOf(node), node.StartPoint().Row)
+	for _, class := range com.Symbols.Resolve(className, treesitter.Kind_Class, imports) {
+		if class.Kind == treesitter.Kind_Function || class.Kind == treesitter.Kind_Constant {
+			continue
+		}
+
+		matches := []Match{}
+		for _, member := range class.Members {
+			// the declaration line is only known for the completed document
+			line := ""
+			if class.URI == doc.Uri {
+				line = declarationAt(doc, member.SelectionRange.Start.Line)
+			}
+
+			switch member.Kind {
+			case treesitter.Kind_Property:
+				matches = append(matches, Match{Text: member.Name, Kind: lsp.Symbol_Kind_Property, Declaration: line})
+			case treesitter.Kind_Method:
+				matches = append(matches, Match{Text: member.Name, Kind: lsp.Symbol_Kind_Method, Declaration: line})
+			}
+		}
+
+		return matches, true
+	}
+
+	return nil, false
+}
+
+// findClass finds the class named name among symbols and the namespaces
+// declared in them.
+func findClass(symbols []lsp.DocumentSymbol, name string) *lsp.DocumentSymbol {
+	for i, symbol := range symbols {
+		if symbol.Name == name && symbol.Kind == treesitter.Kind_Class {
+			return &symbols[i]
+		}
+
+		if symbol.Kind == treesitter.Kind_Namespace {
+			if class := findClass(symbol.Children, name); class != nil {
+				return class
+			}
+		}
+	}
+
+	return nil
+}
+
+func (com *InstanceAccess) findInSymbols(doc *treesitter.TextDocumentItem, matches *[]Match, symbols []lsp.DocumentSymbol) {
 	for _, symbol := range symbols {
 		if symbol.Kind == treesitter.Kind_Property {
-			logger.GetLogger().Printf("Property found: %s of kind %d", symbol.Name, symbol.Kind)
-			*matches = append(*matches, Match{Text: symbol.Name, Kind: lsp.Symbol_Kind_Property})
+			logger.Debugf("Property found: %s of kind %d", symbol.Name, symbol.Kind)
+			*matches = append(*matches, Match{Text: symbol.Name, Kind: lsp.Symbol_Kind_Property, Declaration: declaration(doc, symbol)})
 		}
 
 		if symbol.Kind == treesitter.Kind_Method {
-			logger.GetLogger().Printf("Method found: %s of kind %d", symbol.Name, symbol.Kind)
-			*matches = append(*matches, Match{Text: symbol.Name, Kind: lsp.Symbol_Kind_Method})
+			logger.Debugf("Method found: %s of kind %d", symbol.Name, symbol.Kind)
+			*matches = append(*matches, Match{Text: symbol.Name, Kind: lsp.Symbol_Kind_Method, Declaration: declaration(doc, symbol)})
 		}
 	}
 }
@@ -83,15 +141,9 @@ func (com *InstanceAccess) findObjectName(doc *treesitter.TextDocumentItem, node
 	return ""
 }
 
-func (com *InstanceAccess) findClassName(doc *treesitter.TextDocumentItem, objectName string) string {
-	root, err := treesitter.ParseDocument(doc.Text)
-	if err != nil {
-		logger.GetLogger().Printf("Failed to parse document")
-		return ""
-	}
-
+func (com *InstanceAccess) findClassName(doc *treesitter.TextDocumentItem, root *sitter.Node, objectName string) string {
 	// find node of assignment expression and if left variable name is the object name, then return the right side string
-	nodes := treesitter.FindNodesByType(root.RootNode(), "assignment_expression")
+	nodes := treesitter.FindNodesByType(root, "assignment_expression")
 
 	for _, n := range nodes {
 		left := n.Child(0)
@@ -106,6 +158,6 @@ func (com *InstanceAccess) findClassName(doc *treesitter.TextDocumentItem, objec
 		}
 	}
 
-	logger.GetLogger().Printf("Failed to find class name for object: %s", objectName)
+	logger.Debugf("Failed to find class name for object: %s", objectName)
 	return ""
 }
@@ -0,0 +1,85 @@
+package completor_test
+
+import (
+	complitor "ahmedash95/php-lsp-server/pkg/completor"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/symboltable"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInstanceAccessResolvesImportedClasses(t *testing.T) {
+	table := symboltable.New()
+	declare := func(uri string, code string) {
+		_, declarations := treesitter.Extract(code, treesitter.ModeDeclarations)
+		table.Update(uri, symboltable.FromDeclarations(uri, declarations, func(treesitter.Position) lsp.Range {
+			return lsp.Range{}
+		}))
+	}
+	declare("file:///admin.php", `<?php
+namespace App\Admin;
+class User {
+	public $permissions;
+}`)
+	declare("file:///models.php", `<?php
+namespace App\Models;
+class User {
+	public $name;
+	public function save() {}
+}`)
+
+	tests := map[string]struct {
+		code     string
+		expected []string
+	}{
+		"imported class": {
+			code: `<?php
+namespace App\Http;
+use App\Models\User;
+$user = new User();
+$user->na`,
+			expected: []string{"name", "save"},
+		},
+		"class of the namespace": {
+			code: `<?php
+namespace App\Admin;
+$user = new User();
+$user->na`,
+			expected: []string{"permissions"},
+		},
+		"aliased class": {
+			code: `<?php
+use App\Admin\User as Admin;
+$user = new Admin();
+$user->na`,
+			expected: []string{"permissions"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := document(tt.code)
+			doc.Uri = "file:///controller.php"
+			// the last character of the code
+			line := strings.Count(tt.code, "\n")
+			character := len(tt.code) - strings.LastIndex(tt.code, "\n") - 2
+			node := treesitter.GetNodeAtPosition(tt.code, lsp.Position{Line: line, Character: character})
+
+			completor := complitor.InstanceAccess{Symbols: table}
+			if !completor.CanComplete(doc, node) {
+				t.Fatalf("Expected the member access to be completed")
+			}
+
+			got := []string{}
+			for _, match := range completor.Complete(doc, node) {
+				got = append(got, match.Text)
+			}
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
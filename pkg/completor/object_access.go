@@ -18,7 +18,7 @@ func (com *ObjectAccessing) CanComplete(doc *treesitter.TextDocumentItem, node *
 
 	firstNamedChildIsThis := treesitter.GetNodeText(doc.Text, firstNamedChild) == "$this"
 
-	logger.GetLogger().Printf("Named Child content: %s", treesitter.GetNodeText(doc.Text, firstNamedChild))
+	logger.Debugf("Named Child content: %s", treesitter.GetNodeText(doc.Text, firstNamedChild))
 
 	if node.Type() == "name" && node.Parent().Type() == "member_access_expression" && firstNamedChildIsThis {
 		return true
@@ -32,31 +32,33 @@ func (com *ObjectAccessing) Complete(doc *treesitter.TextDocumentItem, node *sit
 
 	parentScope := com.findParentScope(node)
 
-	logger.GetLogger().Printf("Scope content: %s", doc.Text[parentScope.StartByte():parentScope.EndByte()])
+	logger.Debugf("Scope content: %s", doc.Text[parentScope.StartByte():parentScope.EndByte()])
 
 	// get all variables from parent scope and append to matches
-	com.findInSymbols(node, &matches, parentScope, doc.DocumentSymbols)
+	com.findInSymbols(doc, node, &matches, parentScope, doc.DocumentSymbols)
 	return matches
 }
 
-func (com *ObjectAccessing) findInSymbols(node *sitter.Node, matches *[]Match, parentScope *sitter.Node, symbols []lsp.DocumentSymbol) {
+func (com *ObjectAccessing) findInSymbols(doc *treesitter.TextDocumentItem, node *sitter.Node, matches *[]Match, parentScope *sitter.Node, symbols []lsp.DocumentSymbol) {
 	for _, symbol := range symbols {
 
-		com.findInSymbols(node, matches, parentScope, symbol.Children)
+		com.findInSymbols(doc, node, matches, parentScope, symbol.Children)
 
-		if uint32(symbol.Range.Start.Line) < parentScope.StartPoint().Row || uint32(symbol.Range.End.Line) > parentScope.EndPoint().Row || node.EndPoint().Row < uint32(symbol.Range.Start.Line) {
-			logger.GetLogger().Printf("Symbol %s is out of scope", symbol.Name)
+		// the name tells where the symbol is declared
+		name := symbol.SelectionRange
+		if uint32(name.Start.Line) < parentScope.StartPoint().Row || uint32(name.End.Line) > parentScope.EndPoint().Row || node.EndPoint().Row < uint32(name.Start.Line) {
+			logger.Debugf("Symbol %s is out of scope", symbol.Name)
 			continue
 		}
 
 		if symbol.Kind == treesitter.Kind_Property {
-			logger.GetLogger().Printf("Property found: %s of kind %d", symbol.Name, symbol.Kind)
-			*matches = append(*matches, Match{Text: symbol.Name, Kind: lsp.Symbol_Kind_Property})
+			logger.Debugf("Property found: %s of kind %d", symbol.Name, symbol.Kind)
+			*matches = append(*matches, Match{Text: symbol.Name, Kind: lsp.Symbol_Kind_Property, Declaration: declaration(doc, symbol)})
 		}
 
 		if symbol.Kind == treesitter.Kind_Method {
-			logger.GetLogger().Printf("Method found: %s of kind %d", symbol.Name, symbol.Kind)
-			*matches = append(*matches, Match{Text: symbol.Name, Kind: lsp.Symbol_Kind_Method})
+			logger.Debugf("Method found: %s of kind %d", symbol.Name, symbol.Kind)
+			*matches = append(*matches, Match{Text: symbol.Name, Kind: lsp.Symbol_Kind_Method, Declaration: declaration(doc, symbol)})
 		}
 	}
 }
@@ -19,7 +19,7 @@ func (com *VariablesCompletor) CanComplete(doc *treesitter.TextDocumentItem, nod
 		return true
 	}
 
-	logger.GetLogger().Printf("No variable at -  node type: %s and parent %s", node.Type(), node.Parent().Type())
+	logger.Debugf("No variable at -  node type: %s and parent %s", node.Type(), node.Parent().Type())
 
 	return false
 }
@@ -29,7 +29,7 @@ func (com *VariablesCompletor) Complete(doc *treesitter.TextDocumentItem, node *
 
 	parentScope := findParentScope(node)
 
-	logger.GetLogger().Printf("Scope content: %s", doc.Text[parentScope.StartByte():parentScope.EndByte()])
+	logger.Debugf("Scope content: %s", doc.Text[parentScope.StartByte():parentScope.EndByte()])
 
 	// get all variables from parent scope and append to matches
 	findInSymbols(node, &matches, parentScope, doc.DocumentSymbols)
@@ -41,13 +41,15 @@ func findInSymbols(node *sitter.Node, matches *[]Match, parentScope *sitter.Node
 
 		findInSymbols(node, matches, parentScope, symbol.Children)
 
-		if uint32(symbol.Range.Start.Line) < parentScope.StartPoint().Row || uint32(symbol.Range.End.Line) > parentScope.EndPoint().Row || node.EndPoint().Row < uint32(symbol.Range.Start.Line) {
-			logger.GetLogger().Printf("Symbol %s is out of scope", symbol.Name)
+		// the name tells where the symbol is declared
+		name := symbol.SelectionRange
+		if uint32(name.Start.Line) < parentScope.StartPoint().Row || uint32(name.End.Line) > parentScope.EndPoint().Row || node.EndPoint().Row < uint32(name.Start.Line) {
+			logger.Debugf("Symbol %s is out of scope", symbol.Name)
 			continue
 		}
 
 		if symbol.Kind == treesitter.Kind_Variable {
-			logger.GetLogger().Printf("Variable found: %s of kind %d", symbol.Name, symbol.Kind)
+			logger.Debugf("Variable found: %s of kind %d", symbol.Name, symbol.Kind)
 			*matches = append(*matches, Match{Text: symbol.Name, Kind: lsp.Symbol_Kind_Variable})
 		}
 
@@ -7,6 +7,41 @@ import (
 	"testing"
 )
 
+// rangeOf converts a symbol position, the test code is ASCII so byte
+// offsets are characters.
+func rangeOf(position treesitter.Position) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: int(position.LineStart), Character: int(position.OffsetStart)},
+		End:   lsp.Position{Line: int(position.LineEnd), Character: int(position.OffsetEnd)},
+	}
+}
+
+// document returns an item of code with its symbols, as the workspace
+// stores them.
+func document(code string) *treesitter.TextDocumentItem {
+	var convert func(symbols []treesitter.Symbol) []lsp.DocumentSymbol
+	convert = func(symbols []treesitter.Symbol) []lsp.DocumentSymbol {
+		result := []lsp.DocumentSymbol{}
+		for _, symbol := range symbols {
+			result = append(result, lsp.DocumentSymbol{
+				Name:           symbol.Name,
+				Kind:           int(symbol.Kind),
+				Range:          rangeOf(symbol.Range),
+				SelectionRange: rangeOf(symbol.Position),
+				Children:       convert(symbol.Children),
+			})
+		}
+
+		return result
+	}
+
+	return &treesitter.TextDocumentItem{
+		Text:            code,
+		Lines:           treesitter.NewLineIndex(code),
+		DocumentSymbols: convert(treesitter.GetDocumentSymbols(code)),
+	}
+}
+
 func TestVariablesComplitor(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -27,10 +62,13 @@ echo $n
 			},
 			expected: []complitor.Match{
 				{
-					Text: "$name",
+					Text: "name",
+				},
+				{
+					Text: "num",
 				},
 				{
-					Text: "$num",
+					Text: "n",
 				},
 			},
 		},
@@ -40,8 +78,9 @@ echo $n
 		t.Run(test.name, func(t *testing.T) {
 			node := treesitter.GetNodeAtPosition(test.code, test.position)
 
+			doc := document(test.code)
 			complitor := complitor.VariablesCompletor{}
-			matches := complitor.Complete(node)
+			matches := complitor.Complete(doc, node)
 
 			if len(matches) != len(test.expected) {
 				t.Errorf("Expected %d matches, but got %d", len(test.expected), len(matches))
@@ -55,3 +94,12 @@ echo $n
 		})
 	}
 }
+
+func TestGetCompletionsWithoutNodeAtPosition(t *testing.T) {
+	doc := document("<?php\n$name = 1;\n")
+
+	completor := complitor.NewCompletor(nil)
+	if matches := completor.GetCompletions(doc, lsp.Position{Line: 20, Character: 3}); len(matches) != 0 {
+		t.Errorf("Expected no completions, got %v", matches)
+	}
+}
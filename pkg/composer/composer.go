@@ -0,0 +1,309 @@
+package composer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Paths is a list of directories or files, composer.json allows a single
+// string wherever a list is expected.
+type Paths []string
+
+func (p *Paths) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*p = Paths{path}
+		return nil
+	}
+
+	var paths []string
+	if err := json.Unmarshal(data, &paths); err != nil {
+		return err
+	}
+
+	*p = paths
+	return nil
+}
+
+// Autoload is the autoload section of composer.json or of a package in
+// installed.json.
+type Autoload struct {
+	PSR4     map[string]Paths `json:"psr-4"`
+	PSR0     map[string]Paths `json:"psr-0"`
+	Classmap []string         `json:"classmap"`
+	Files    []string         `json:"files"`
+}
+
+type composerJSON struct {
+	Autoload    Autoload `json:"autoload"`
+	AutoloadDev Autoload `json:"autoload-dev"`
+	Config      struct {
+		VendorDir string `json:"vendor-dir"`
+	} `json:"config"`
+}
+
+type installedPackage struct {
+	Name        string   `json:"name"`
+	Autoload    Autoload `json:"autoload"`
+	InstallPath string   `json:"install-path"`
+}
+
+// mapping maps a namespace prefix to the directories its classes live in.
+type mapping struct {
+	prefix string
+	dirs   []string
+}
+
+// Project resolves classes to files the way the composer autoloader of a
+// project does, for the project itself and its installed dependencies.
+type Project struct {
+	Root      string
+	VendorDir string
+	// Files are the files every request loads, they usually declare
+	// functions.
+	Files []string
+
+	psr4 []mapping
+	psr0 []mapping
+	// classmap maps fully qualified class names to their file.
+	classmap map[string]string
+}
+
+// Load reads the composer.json of the project at root and the dependencies
+// installed in its vendor directory. The error wraps os.ErrNotExist when the
+// project does not use composer.
+func Load(root string) (*Project, error) {
+	content, err := os.ReadFile(filepath.Join(root, "composer.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest composerJSON
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+
+	vendorDir := manifest.Config.VendorDir
+	if vendorDir == "" {
+		vendorDir = "vendor"
+	}
+	if !filepath.IsAbs(vendorDir) {
+		vendorDir = filepath.Join(root, vendorDir)
+	}
+
+	p := &Project{
+		Root:      root,
+		VendorDir: vendorDir,
+		classmap:  map[string]string{},
+	}
+
+	p.add(root, manifest.Autoload)
+	p.add(root, manifest.AutoloadDev)
+
+	for _, pkg := range p.installedPackages() {
+		p.add(pkg.InstallPath, pkg.Autoload)
+	}
+
+	// the generated classmap also holds the classes of classmap
+	// directories, which can only be found by parsing them
+	p.loadClassmap()
+
+	// the longest prefix wins when several match a class
+	for _, mappings := range [][]mapping{p.psr4, p.psr0} {
+		sort.SliceStable(mappings, func(i, j int) bool {
+			return len(mappings[i].prefix) > len(mappings[j].prefix)
+		})
+	}
+
+	return p, nil
+}
+
+func (p *Project) add(dir string, autoload Autoload) {
+	for prefix, paths := range autoload.PSR4 {
+		p.psr4 = append(p.psr4, mapping{prefix: prefix, dirs: join(dir, paths)})
+	}
+
+	for prefix, paths := range autoload.PSR0 {
+		p.psr0 = append(p.psr0, mapping{prefix: prefix, dirs: join(dir, paths)})
+	}
+
+	p.Files = append(p.Files, join(dir, autoload.Files)...)
+}
+
+// installedPackages reads vendor/composer/installed.json, in the format of
+// composer 2 or of composer 1.
+func (p *Project) installedPackages() []installedPackage {
+	composerDir := filepath.Join(p.VendorDir, "composer")
+
+	content, err := os.ReadFile(filepath.Join(composerDir, "installed.json"))
+	if err != nil {
+		return nil
+	}
+
+	var installed struct {
+		Packages []installedPackage `json:"packages"`
+	}
+	if err := json.Unmarshal(content, &installed); err != nil {
+		if err := json.Unmarshal(content, &installed.Packages); err != nil {
+			return nil
+		}
+	}
+
+	for i, pkg := range installed.Packages {
+		if pkg.InstallPath == "" {
+			installed.Packages[i].InstallPath = filepath.Join(p.VendorDir, filepath.FromSlash(pkg.Name))
+		} else {
+			installed.Packages[i].InstallPath = filepath.Join(composerDir, filepath.FromSlash(pkg.InstallPath))
+		}
+	}
+
+	return installed.Packages
+}
+
+// classmapEntry matches the entries of autoload_classmap.php such as
+// 'App\\User' => $baseDir . '/app/User.php',
+var classmapEntry = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'\s*=>\s*\$(baseDir|vendorDir)\s*\.\s*'((?:[^'\\]|\\.)*)'`)
+
+func (p *Project) loadClassmap() {
+	content, err := os.ReadFile(filepath.Join(p.VendorDir, "composer", "autoload_classmap.php"))
+	if err != nil {
+		return
+	}
+
+	for _, match := range classmapEntry.FindAllStringSubmatch(string(content), -1) {
+		base := p.Root
+		if match[2] == "vendorDir" {
+			base = p.VendorDir
+		}
+
+		p.classmap[unquote(match[1])] = filepath.Join(base, filepath.FromSlash(unquote(match[3])))
+	}
+}
+
+// ClassFiles returns the files that may define class, in the order the
+// autoloader tries them. The files are not required to exist.
+func (p *Project) ClassFiles(class string) []string {
+	class = strings.TrimPrefix(class, "\\")
+
+	var files []string
+	if file, ok := p.classmap[class]; ok {
+		files = append(files, file)
+	}
+
+	relative := strings.ReplaceAll(class, "\\", string(filepath.Separator)) + ".php"
+	for _, m := range p.psr4 {
+		if !strings.HasPrefix(class, m.prefix) {
+			continue
+		}
+
+		for _, dir := range m.dirs {
+			files = append(files, filepath.Join(dir, relative[len(m.prefix):]))
+		}
+	}
+
+	// PSR-0 also turns underscores of the class name into directories
+	namespace, name := "", class
+	if i := strings.LastIndex(class, "\\"); i >= 0 {
+		namespace, name = class[:i+1], class[i+1:]
+	}
+	relative = strings.ReplaceAll(namespace, "\\", string(filepath.Separator)) + strings.ReplaceAll(name, "_", string(filepath.Separator)) + ".php"
+	for _, m := range p.psr0 {
+		if !strings.HasPrefix(class, m.prefix) {
+			continue
+		}
+
+		for _, dir := range m.dirs {
+			files = append(files, filepath.Join(dir, relative))
+		}
+	}
+
+	return files
+}
+
+// FindClass returns the file that defines class, the first candidate of
+// ClassFiles that exists.
+func (p *Project) FindClass(class string) (string, bool) {
+	for _, file := range p.ClassFiles(class) {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file, true
+		}
+	}
+
+	return "", false
+}
+
+// Namespace returns the namespace the file at path must declare for the
+// autoloader to find its class, without leading or trailing separator.
+func (p *Project) Namespace(path string) (string, bool) {
+	namespace, found, longest := "", false, -1
+
+	for _, m := range p.psr4 {
+		for _, dir := range m.dirs {
+			relative, ok := relativeDir(dir, path)
+			if !ok || len(dir) <= longest {
+				continue
+			}
+
+			namespace = m.prefix + strings.ReplaceAll(relative, string(filepath.Separator), "\\")
+			found, longest = true, len(dir)
+		}
+	}
+
+	for _, m := range p.psr0 {
+		for _, dir := range m.dirs {
+			relative, ok := relativeDir(dir, path)
+			if !ok || len(dir) <= longest {
+				continue
+			}
+
+			// PSR-0 directories hold the whole namespace
+			candidate := strings.ReplaceAll(relative, string(filepath.Separator), "\\")
+			if prefix := strings.TrimRight(m.prefix, "\\_"); !strings.HasPrefix(candidate, prefix) {
+				continue
+			}
+
+			namespace = candidate
+			found, longest = true, len(dir)
+		}
+	}
+
+	return strings.Trim(namespace, "\\"), found
+}
+
+// IsVendor tells whether path belongs to an installed dependency.
+func (p *Project) IsVendor(path string) bool {
+	_, ok := relativeDir(p.VendorDir, path)
+	return ok
+}
+
+// relativeDir returns the directory of path relative to dir, if path is in
+// dir.
+func relativeDir(dir string, path string) (string, bool) {
+	relative, err := filepath.Rel(dir, filepath.Dir(path))
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	if relative == "." {
+		relative = ""
+	}
+
+	return relative, true
+}
+
+func join(dir string, paths []string) []string {
+	joined := make([]string, 0, len(paths))
+	for _, path := range paths {
+		joined = append(joined, filepath.Join(dir, filepath.FromSlash(path)))
+	}
+
+	return joined
+}
+
+func unquote(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\'`, `'`).Replace(s)
+}
@@ -0,0 +1,148 @@
+package composer_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/composer"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const project = "../../tests/pkg/composer/project"
+
+func TestFindClass(t *testing.T) {
+	p, err := composer.Load(project)
+	if err != nil {
+		t.Fatalf("Error loading project: %s", err)
+	}
+
+	tests := map[string]struct {
+		class string
+		file  string
+		found bool
+	}{
+		"psr-4":                {class: "App\\Models\\User", file: "app/Models/User.php", found: true},
+		"leading separator":    {class: "\\App\\Models\\User", file: "app/Models/User.php", found: true},
+		"autoload-dev":         {class: "Tests\\Unit\\UserTest", file: "tests/Unit/UserTest.php", found: true},
+		"psr-0 underscores":    {class: "Legacy_Mail_Sender", file: "legacy/Legacy/Mail/Sender.php", found: true},
+		"installed dependency": {class: "Acme\\Http\\Client\\Request", file: "vendor/acme/http/src/Client/Request.php", found: true},
+		"missing class":        {class: "App\\Models\\Post", found: false},
+		"unknown namespace":    {class: "Other\\Thing", found: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			file, found := p.FindClass(tt.class)
+			if found != tt.found {
+				t.Fatalf("Expected found %v, got %v (%s)", tt.found, found, file)
+			}
+
+			if found && file != filepath.Join(project, tt.file) {
+				t.Errorf("Expected %v, got %v", filepath.Join(project, tt.file), file)
+			}
+		})
+	}
+}
+
+func TestClassFiles(t *testing.T) {
+	p, err := composer.Load(project)
+	if err != nil {
+		t.Fatalf("Error loading project: %s", err)
+	}
+
+	tests := map[string]struct {
+		class    string
+		expected []string
+	}{
+		"classmap":        {class: "Generated\\Proxy", expected: []string{"storage/proxies/Proxy.php"}},
+		"vendor classmap": {class: "Composer\\InstalledVersions", expected: []string{"vendor/composer/InstalledVersions.php"}},
+		"psr-4":           {class: "App\\Http\\Controller", expected: []string{"app/Http/Controller.php"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			files := p.ClassFiles(tt.class)
+			if len(files) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, files)
+			}
+
+			for i, file := range tt.expected {
+				if files[i] != filepath.Join(project, file) {
+					t.Errorf("Expected %v, got %v", filepath.Join(project, file), files[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	p, err := composer.Load(project)
+	if err != nil {
+		t.Fatalf("Error loading project: %s", err)
+	}
+
+	tests := map[string]struct {
+		file      string
+		namespace string
+		found     bool
+	}{
+		"psr-4 root":           {file: "app/Kernel.php", namespace: "App", found: true},
+		"psr-4 subdirectory":   {file: "app/Models/User.php", namespace: "App\\Models", found: true},
+		"installed dependency": {file: "vendor/acme/http/src/Client/Request.php", namespace: "Acme\\Http\\Client", found: true},
+		"psr-0":                {file: "legacy/Legacy/Mail/Sender.php", namespace: "Legacy\\Mail", found: true},
+		"outside autoload":     {file: "public/index.php", found: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			namespace, found := p.Namespace(filepath.Join(project, tt.file))
+			if found != tt.found || namespace != tt.namespace {
+				t.Errorf("Expected %q (%v), got %q (%v)", tt.namespace, tt.found, namespace, found)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	p, err := composer.Load(project)
+	if err != nil {
+		t.Fatalf("Error loading project: %s", err)
+	}
+
+	expected := []string{"app/helpers.php", "vendor/acme/http/helpers/functions.php"}
+	if len(p.Files) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, p.Files)
+	}
+	for i, file := range expected {
+		if p.Files[i] != filepath.Join(project, file) {
+			t.Errorf("Expected %v, got %v", filepath.Join(project, file), p.Files[i])
+		}
+	}
+
+	if !p.IsVendor(filepath.Join(project, "vendor/acme/http/src/Client/Request.php")) || p.IsVendor(filepath.Join(project, "app/Models/User.php")) {
+		t.Errorf("Expected only files of the vendor directory to be vendor files")
+	}
+
+	if _, err := composer.Load(t.TempDir()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestLoadAbsoluteVendorDir(t *testing.T) {
+	root := t.TempDir()
+	vendor := filepath.Join(t.TempDir(), "vendor")
+	manifest := `{"config":{"vendor-dir":` + strconv.Quote(vendor) + `}}`
+	if err := os.WriteFile(filepath.Join(root, "composer.json"), []byte(manifest), 0644); err != nil {
+		t.Fatalf("Error writing composer.json: %s", err)
+	}
+
+	p, err := composer.Load(root)
+	if err != nil {
+		t.Fatalf("Error loading project: %s", err)
+	}
+
+	if p.VendorDir != vendor {
+		t.Errorf("Expected %q, got %q", vendor, p.VendorDir)
+	}
+}
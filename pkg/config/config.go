@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"runtime"
+)
+
+// Config holds the settings a client passes in the initializationOptions of
+// initialize. Every setting is optional.
+type Config struct {
+	Indexing Indexing `json:"indexing"`
+	Cache    Cache    `json:"cache"`
+	Memory   Memory   `json:"memory"`
+}
+
+type Indexing struct {
+	// Workers is the most files parsed at the same time, zero picks a
+	// number based on GOMAXPROCS.
+	Workers int `json:"workers"`
+	// LibraryPaths are directories, relative to the workspace root, whose
+	// files only need their declarations indexed, like stubs. The composer
+	// vendor directory always is one.
+	LibraryPaths []string `json:"libraryPaths"`
+	// Exclude holds gitignore style patterns, relative to the workspace
+	// root, of files and directories not indexed. Setting it replaces the
+	// defaults.
+	Exclude []string `json:"exclude"`
+	// Include holds directories indexed even when excluded or ignored,
+	// they may be outside the workspace root, like shared libraries.
+	Include []string `json:"include"`
+	// MaxFileSize skips files bigger than it in bytes, zero for no limit.
+	MaxFileSize int64 `json:"maxFileSize"`
+	// Gitignore skips the files ignored by the .gitignore files of the
+	// workspace. The vendor directory and library paths are still indexed.
+	Gitignore bool `json:"gitignore"`
+	// PollInterval is how many seconds pass between two looks for changed
+	// sources of the project when the client cannot watch files, zero
+	// disables polling.
+	PollInterval int `json:"pollInterval"`
+}
+
+type Cache struct {
+	// Enabled keeps the symbols of indexed files on disk between runs.
+	Enabled bool `json:"enabled"`
+	// Directory holds the cache, the user cache directory when empty.
+	Directory string `json:"directory"`
+}
+
+type Memory struct {
+	// Budget is how many megabytes the files read back from disk for
+	// requests may take along with their syntax trees. The least recently
+	// used are dropped first, open documents are not counted.
+	Budget int `json:"budget"`
+}
+
+func Default() Config {
+	return Config{
+		Indexing: Indexing{
+			Exclude:      []string{".git", "node_modules", "/storage", "/bootstrap/cache", "/var/cache"},
+			MaxFileSize:  2 << 20,
+			Gitignore:    true,
+			PollInterval: 30,
+		},
+		Cache: Cache{
+			Enabled: true,
+		},
+		Memory: Memory{
+			Budget: 64,
+		},
+	}
+}
+
+// Decode reads the initializationOptions of a client, settings it does not
+// set keep their default.
+func Decode(options json.RawMessage) (Config, error) {
+	return Default().Merge(options)
+}
+
+// Merge returns the config with the settings in options applied over it,
+// like the settings of a single workspace folder over those of the client.
+// It is returned unchanged when options are invalid.
+func (c Config) Merge(options json.RawMessage) (Config, error) {
+	if len(options) == 0 || string(options) == "null" {
+		return c, nil
+	}
+
+	// decoding an array reuses the backing array of the slice, c must not
+	// share them with the config it was copied from
+	merged := c
+	merged.Indexing.LibraryPaths = append([]string(nil), c.Indexing.LibraryPaths...)
+	merged.Indexing.Exclude = append([]string(nil), c.Indexing.Exclude...)
+	merged.Indexing.Include = append([]string(nil), c.Indexing.Include...)
+
+	if err := json.Unmarshal(options, &merged); err != nil {
+		return c, err
+	}
+
+	return merged, nil
+}
+
+// IndexWorkers returns how many files to parse concurrently. One processor
+// is left for requests so open documents stay responsive while indexing.
+func (c Config) IndexWorkers() int {
+	workers := runtime.GOMAXPROCS(0) - 1
+	if c.Indexing.Workers > 0 && c.Indexing.Workers < workers {
+		workers = c.Indexing.Workers
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	return workers
+}
@@ -0,0 +1,99 @@
+package config_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/config"
+	"encoding/json"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func withDefaults(change func(c *config.Config)) config.Config {
+	c := config.Default()
+	change(&c)
+
+	return c
+}
+
+func TestDecode(t *testing.T) {
+	tests := map[string]struct {
+		options  string
+		expected config.Config
+		err      bool
+	}{
+		"no options":   {options: ``, expected: config.Default()},
+		"null options": {options: `null`, expected: config.Default()},
+		"indexing": {options: `{"indexing":{"workers":2}}`, expected: withDefaults(func(c *config.Config) {
+			c.Indexing.Workers = 2
+		})},
+		"library paths": {options: `{"indexing":{"libraryPaths":["stubs"]}}`, expected: withDefaults(func(c *config.Config) {
+			c.Indexing.LibraryPaths = []string{"stubs"}
+		})},
+		"scan rules": {options: `{"indexing":{"exclude":["/tmp"],"include":["../shared"],"maxFileSize":1024,"gitignore":false}}`, expected: withDefaults(func(c *config.Config) {
+			c.Indexing.Exclude = []string{"/tmp"}
+			c.Indexing.Include = []string{"../shared"}
+			c.Indexing.MaxFileSize = 1024
+			c.Indexing.Gitignore = false
+		})},
+		"cache": {options: `{"cache":{"enabled":false,"directory":"/tmp/cache"}}`, expected: withDefaults(func(c *config.Config) {
+			c.Cache = config.Cache{Enabled: false, Directory: "/tmp/cache"}
+		})},
+		"unknown setting": {options: `{"other":true}`, expected: config.Default()},
+		"invalid":         {options: `{"indexing":{"workers":"two"}}`, expected: config.Default(), err: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := config.Decode(json.RawMessage(tt.options))
+			if (err != nil) != tt.err {
+				t.Errorf("Expected error %v, got %v", tt.err, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIndexWorkers(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	tests := map[string]struct {
+		workers  int
+		expected int
+	}{
+		"default leaves a processor for requests": {workers: 0, expected: 3},
+		"configured limit":                        {workers: 2, expected: 2},
+		"limit above GOMAXPROCS":                  {workers: 16, expected: 3},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := config.Config{Indexing: config.Indexing{Workers: tt.workers}}.IndexWorkers()
+			if got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMergeKeepsTheBaseConfig(t *testing.T) {
+	base := withDefaults(func(c *config.Config) {
+		c.Indexing.Workers = 2
+		c.Indexing.Exclude = []string{"/a", "/b"}
+	})
+
+	merged, err := base.Merge(json.RawMessage(`{"indexing":{"exclude":["/c"]}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if merged.Indexing.Workers != 2 || !reflect.DeepEqual(merged.Indexing.Exclude, []string{"/c"}) {
+		t.Errorf("Expected the folder settings over the base ones, got %v", merged)
+	}
+
+	if !reflect.DeepEqual(base.Indexing.Exclude, []string{"/a", "/b"}) {
+		t.Errorf("Expected the base config to be unchanged, got %v", base.Indexing.Exclude)
+	}
+}
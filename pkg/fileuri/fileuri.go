@@ -0,0 +1,115 @@
+// Package fileuri converts between file paths and the file URIs of the
+// protocol, as described by RFC 8089.
+package fileuri
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const scheme = "file://"
+
+// FromPath returns the URI of the file at path, an absolute path. Bytes
+// outside of those allowed in a URI path are percent-encoded and Windows
+// drive letters are upper cased.
+func FromPath(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	if strings.HasPrefix(path, "//") {
+		// a UNC path, its server is the authority of the URI
+		host, share, _ := strings.Cut(path[2:], "/")
+		return scheme + host + escape("/"+share)
+	}
+
+	if hasDrive(path) {
+		path = "/" + strings.ToUpper(path[:1]) + path[1:]
+	}
+
+	return scheme + escape(path)
+}
+
+// ToPath returns the cleaned path of the file at uri, uri itself when it is
+// not a file URI. Percent signs clients did not encode are tolerated.
+func ToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil && strings.HasPrefix(uri, scheme) {
+		return filepath.Clean(filepath.FromSlash(strings.TrimPrefix(uri, scheme)))
+	}
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	path := u.Path
+	if hasDrive(strings.TrimPrefix(path, "/")) {
+		path = strings.TrimPrefix(path, "/")
+		path = strings.ToUpper(path[:1]) + path[1:]
+	} else if u.Host != "" && u.Host != "localhost" {
+		path = "//" + u.Host + path
+	}
+
+	return filepath.Clean(filepath.FromSlash(path))
+}
+
+// Canonical returns the URI of the file at uri with symlinks resolved and
+// a single encoding, so the same file always has the same URI. URIs of other
+// schemes are returned unchanged.
+func Canonical(uri string) string {
+	if !strings.HasPrefix(uri, "file:") {
+		return uri
+	}
+
+	return FromPath(CanonicalPath(ToPath(uri)))
+}
+
+// CanonicalPath returns path cleaned and with symlinks resolved. Only the
+// existing parents of a path that does not exist are resolved, like those of
+// a deleted file.
+func CanonicalPath(path string) string {
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+
+	dir := filepath.Dir(path)
+	if dir == path {
+		return path
+	}
+
+	return filepath.Join(CanonicalPath(dir), filepath.Base(path))
+}
+
+func hasDrive(path string) bool {
+	return len(path) >= 2 && path[1] == ':' &&
+		(path[0] >= 'a' && path[0] <= 'z' || path[0] >= 'A' && path[0] <= 'Z') &&
+		(len(path) == 2 || path[2] == '/')
+}
+
+// escape percent-encodes path, keeping the unreserved characters, the
+// sub-delims and the separators allowed in a URI path.
+func escape(path string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if allowed(c) {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+
+	return b.String()
+}
+
+func allowed(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+
+	return strings.IndexByte("-._~!$&'()*+,;=:@/", c) >= 0
+}
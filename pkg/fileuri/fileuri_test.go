@@ -0,0 +1,99 @@
+package fileuri_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/fileuri"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFromPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("paths are unix paths")
+	}
+
+	tests := map[string]string{
+		"/home/user/app/User.php":     "file:///home/user/app/User.php",
+		"/home/user/my app/a.php":     "file:///home/user/my%20app/a.php",
+		"/home/user/app/#1?.php":      "file:///home/user/app/%231%3F.php",
+		"/home/user/100%/a.php":       "file:///home/user/100%25/a.php",
+		"/home/user/café/a.php":       "file:///home/user/caf%C3%A9/a.php",
+		"/home/user/a+b/c@d$e.php":    "file:///home/user/a+b/c@d$e.php",
+		"/home/user/app/../lib/a.php": "file:///home/user/lib/a.php",
+		"c:/Users/app/a.php":          "file:///C:/Users/app/a.php",
+	}
+
+	for path, expected := range tests {
+		t.Run(path, func(t *testing.T) {
+			if uri := fileuri.FromPath(path); uri != expected {
+				t.Errorf("Expected %s, got %s", expected, uri)
+			}
+		})
+	}
+}
+
+func TestToPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("paths are unix paths")
+	}
+
+	tests := map[string]string{
+		"file:///home/user/app/User.php":        "/home/user/app/User.php",
+		"file:///home/user/my%20app/a.php":      "/home/user/my app/a.php",
+		"file:///home/user/caf%C3%A9/a.php":     "/home/user/café/a.php",
+		"file://localhost/home/user/a.php":      "/home/user/a.php",
+		"file:///c%3A/Users/app/a.php":          "C:/Users/app/a.php",
+		"file:///C:/Users/app/a.php":            "C:/Users/app/a.php",
+		"file:///home/user/100%/a.php":          "/home/user/100%/a.php",
+		"untitled:Untitled-1":                   "untitled:Untitled-1",
+		"file:///home/user/app/%231%3F.php":     "/home/user/app/#1?.php",
+		"file:///home/user/a+b/c@d$e.php":       "/home/user/a+b/c@d$e.php",
+		"file:///home/user/app/nested/../x.php": "/home/user/app/x.php",
+	}
+
+	for uri, expected := range tests {
+		t.Run(uri, func(t *testing.T) {
+			if path := fileuri.ToPath(uri); path != expected {
+				t.Errorf("Expected %s, got %s", expected, path)
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	dir := fileuri.CanonicalPath(t.TempDir())
+	os.MkdirAll(filepath.Join(dir, "packages", "acme"), 0755)
+	os.WriteFile(filepath.Join(dir, "packages", "acme", "a.php"), []byte("<?php"), 0644)
+	os.MkdirAll(filepath.Join(dir, "vendor"), 0755)
+	if err := os.Symlink(filepath.Join(dir, "packages", "acme"), filepath.Join(dir, "vendor", "acme")); err != nil {
+		t.Skipf("Symlinks are not supported: %s", err)
+	}
+
+	real := fileuri.FromPath(filepath.Join(dir, "packages", "acme", "a.php"))
+	tests := map[string]string{
+		"the file itself":          real,
+		"through the symlink":      fileuri.FromPath(filepath.Join(dir, "vendor", "acme", "a.php")),
+		"with a parent reference":  fileuri.FromPath(filepath.Join(dir, "vendor", "acme", "..", "..", "packages", "acme", "a.php")),
+		"encoded differently":      "file://" + filepath.ToSlash(filepath.Join(dir, "packages", "acme")) + "/%61.php",
+		"a file that is not there": fileuri.FromPath(filepath.Join(dir, "vendor", "acme", "b.php")),
+		"another scheme":           "untitled:Untitled-1",
+	}
+	expected := map[string]string{
+		"a file that is not there": fileuri.FromPath(filepath.Join(dir, "packages", "acme", "b.php")),
+		"another scheme":           "untitled:Untitled-1",
+	}
+
+	for name, uri := range tests {
+		t.Run(name, func(t *testing.T) {
+			want, ok := expected[name]
+			if !ok {
+				want = real
+			}
+
+			if canonical := fileuri.Canonical(uri); canonical != want {
+				t.Errorf("Expected %s, got %s", want, canonical)
+			}
+		})
+	}
+}
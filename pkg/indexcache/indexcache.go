@@ -0,0 +1,347 @@
+package indexcache
+
+import (
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaVersion must change whenever the layout or the format of the cache
+// changes.
+const schemaVersion = 2
+
+// Cache keeps the symbols extracted from files on disk between runs, so a
+// restart only parses the files that changed.
+//
+// Symbols are stored by the hash of the content they were extracted from,
+// so worktrees and copies of the same repository share them. Each workspace
+// root has a manifest remembering the size, modification time and hash of
+// its files, a file that did not change is not even hashed again.
+type Cache struct {
+	dir          string
+	manifestPath string
+
+	// mu guards previous, the manifest of the last run, and current, the
+	// one of this run. current starts as a copy of previous, so files this
+	// run did not index keep their entry. stored holds the hashes of the
+	// manifest on disk.
+	mu       sync.Mutex
+	previous map[string]Entry
+	current  map[string]Entry
+	stored   map[string]bool
+}
+
+// Entry describes a file of the workspace as it was when it was indexed.
+type Entry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	Hash    string `json:"hash"`
+}
+
+// DefaultDir is the cache directory of the current user.
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "php-lsp-server", "index")
+}
+
+// Open opens the cache of the workspace at root, stored under dir. Caches
+// another version of the server or of the extractor has not written to for
+// a while are removed.
+func Open(dir string, root string) (*Cache, error) {
+	version := fmt.Sprintf("v%d-%d", schemaVersion, treesitter.ExtractorVersion)
+	versionDir := filepath.Join(dir, version)
+
+	if err := os.MkdirAll(versionDir, 0700); err != nil {
+		return nil, err
+	}
+	removeOtherVersions(dir, version)
+
+	rootHash := sha256.Sum256([]byte(root))
+	c := &Cache{
+		dir:          versionDir,
+		manifestPath: filepath.Join(versionDir, "roots", hex.EncodeToString(rootHash[:8])+".json"),
+		previous:     map[string]Entry{},
+		current:      map[string]Entry{},
+	}
+
+	// a missing or broken manifest only means every file is hashed again
+	if content, err := os.ReadFile(c.manifestPath); err == nil {
+		json.Unmarshal(content, &c.previous)
+	}
+	for path, entry := range c.previous {
+		c.current[path] = entry
+	}
+	c.stored = hashes(c.previous)
+
+	return c, nil
+}
+
+// versionName matches the directories Open names after a version, the
+// only ones removeOtherVersions may remove as dir is configurable.
+var versionName = regexp.MustCompile(`^v\d+-\d+$`)
+
+// staleAfter is how long the cache of another version must not have been
+// written to before it is removed. A server of that version may still be
+// running, it writes its manifests whenever files change.
+const staleAfter = 30 * 24 * time.Hour
+
+func removeOtherVersions(dir string, version string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !versionName.MatchString(entry.Name()) || entry.Name() == version {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if written, ok := lastWritten(path); ok && time.Since(written) > staleAfter {
+			os.RemoveAll(path)
+		}
+	}
+}
+
+// lastWritten returns when a manifest of the version cache at dir was last
+// written, or when dir was created if none was.
+func lastWritten(dir string) (time.Time, bool) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	last := info.ModTime()
+	manifests, _ := os.ReadDir(filepath.Join(dir, "roots"))
+	for _, manifest := range manifests {
+		if info, err := manifest.Info(); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+
+	return last, true
+}
+
+// Key returns the hash identifying content, the file at path relative to
+// the root. It is taken from the manifest when the file did not change.
+func (c *Cache) Key(path string, info fs.FileInfo, content []byte) string {
+	c.mu.Lock()
+	entry, ok := c.previous[path]
+	c.mu.Unlock()
+
+	if ok && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano() && entry.Size == int64(len(content)) {
+		return entry.Hash
+	}
+
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+// Symbols returns the symbols extracted in mode from the content with the
+// given hash.
+func (c *Cache) Symbols(hash string, mode treesitter.Mode) ([]treesitter.Symbol, bool) {
+	path := c.symbolsPath(hash, mode)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var symbols []treesitter.Symbol
+	if err := json.Unmarshal(content, &symbols); err != nil {
+		// left broken by a crash, StoreSymbols writes it again
+		os.Remove(path)
+		return nil, false
+	}
+
+	return symbols, true
+}
+
+// StoreSymbols stores the symbols extracted in mode from the content with
+// the given hash.
+func (c *Cache) StoreSymbols(hash string, mode treesitter.Mode, symbols []treesitter.Symbol) error {
+	path := c.symbolsPath(hash, mode)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if symbols == nil {
+		symbols = []treesitter.Symbol{}
+	}
+
+	content, err := json.Marshal(symbols)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return writeFile(path, content, false)
+}
+
+// Remember records the state of the file at path for the manifest of this
+// run.
+func (c *Cache) Remember(path string, info fs.FileInfo, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.current[path] = Entry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Hash:    hash,
+	}
+}
+
+// Forget drops the file at path from the manifest of this run.
+func (c *Cache) Forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.current, path)
+}
+
+// Retain drops from the manifest of this run the files that are not among
+// found, the files of a complete walk of the root.
+func (c *Cache) Retain(found map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for path := range c.current {
+		if !found[path] {
+			delete(c.current, path)
+		}
+	}
+}
+
+// Flush writes the manifest of this run. The symbols of the contents it no longer refers to are
+// removed, unless the manifest of another root refers to them.
+func (c *Cache) Flush() error {
+	c.mu.Lock()
+	content, err := json.Marshal(c.current)
+	current := hashes(c.current)
+	c.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.manifestPath), 0700); err != nil {
+		return err
+	}
+
+	if err := writeFile(c.manifestPath, content, true); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	dropped := map[string]bool{}
+	for hash := range c.stored {
+		if !current[hash] {
+			dropped[hash] = true
+		}
+	}
+	c.stored = current
+	c.mu.Unlock()
+
+	c.prune(dropped)
+	return nil
+}
+
+// prune removes the symbols of the dropped hashes no manifest refers to.
+func (c *Cache) prune(dropped map[string]bool) {
+	if len(dropped) == 0 {
+		return
+	}
+
+	roots := filepath.Dir(c.manifestPath)
+	entries, err := os.ReadDir(roots)
+	if err != nil {
+		return
+	}
+
+	for _, file := range entries {
+		path := filepath.Join(roots, file.Name())
+		if path == c.manifestPath || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var manifest map[string]Entry
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			continue
+		}
+
+		for _, entry := range manifest {
+			delete(dropped, entry.Hash)
+		}
+	}
+
+	for hash := range dropped {
+		for _, mode := range []treesitter.Mode{treesitter.ModeFull, treesitter.ModeDeclarations} {
+			os.Remove(c.symbolsPath(hash, mode))
+		}
+	}
+}
+
+// hashes returns the set of the hashes of a manifest.
+func hashes(manifest map[string]Entry) map[string]bool {
+	set := make(map[string]bool, len(manifest))
+	for _, entry := range manifest {
+		set[entry.Hash] = true
+	}
+
+	return set
+}
+
+func (c *Cache) symbolsPath(hash string, mode treesitter.Mode) string {
+	return filepath.Join(c.dir, "symbols", hash[:2], hash+"."+mode.String()+".json")
+}
+
+// writeFile replaces the file at path atomically, a crash leaves either the
+// old or the new content but never a partial file. The content is only
+// synced to disk first when sync is set, else a crash may leave the file
+// empty, which is only worth it for the manifest: a broken symbols file is
+// a cache miss.
+func writeFile(path string, content []byte, sync bool) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+
+	if sync {
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,182 @@
+package indexcache_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/indexcache"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, content string) os.FileInfo {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err)
+	}
+
+	return info
+}
+
+func TestCacheSymbols(t *testing.T) {
+	dir := t.TempDir()
+	root := t.TempDir()
+
+	cache, err := indexcache.Open(dir, root)
+	if err != nil {
+		t.Fatalf("Error opening cache: %s", err)
+	}
+
+	content := "<?php\nclass Foo {}"
+	info := writeFile(t, filepath.Join(root, "a.php"), content)
+
+	hash := cache.Key("a.php", info, []byte(content))
+	if _, ok := cache.Symbols(hash, treesitter.ModeFull); ok {
+		t.Fatalf("Expected an empty cache")
+	}
+
+	symbols := []treesitter.Symbol{{Name: "Foo", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 6, OffsetEnd: 9}}}
+	if err := cache.StoreSymbols(hash, treesitter.ModeFull, symbols); err != nil {
+		t.Fatalf("Error storing symbols: %s", err)
+	}
+	cache.Remember("a.php", info, hash)
+	if err := cache.Flush(); err != nil {
+		t.Fatalf("Error flushing cache: %s", err)
+	}
+
+	// another worktree with the same content shares the symbols
+	other, err := indexcache.Open(dir, t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening cache: %s", err)
+	}
+
+	got, ok := other.Symbols(other.Key("a.php", info, []byte(content)), treesitter.ModeFull)
+	if !ok || len(got) != 1 || got[0].Name != symbols[0].Name || got[0].Position != symbols[0].Position {
+		t.Errorf("Expected %v, got %v", symbols, got)
+	}
+
+	if _, ok := other.Symbols(hash, treesitter.ModeDeclarations); ok {
+		t.Errorf("Expected symbols of another mode not to be shared")
+	}
+
+	// an unchanged file is not hashed again, the manifest is trusted
+	reopened, err := indexcache.Open(dir, root)
+	if err != nil {
+		t.Fatalf("Error opening cache: %s", err)
+	}
+
+	if key := reopened.Key("a.php", info, []byte("<?php\nclass Bar {}")); key != hash {
+		t.Errorf("Expected %v, got %v", hash, key)
+	}
+
+	changed := writeFile(t, filepath.Join(root, "a.php"), "<?php\nclass Changed {}")
+	if key := reopened.Key("a.php", changed, []byte("<?php\nclass Changed {}")); key == hash {
+		t.Errorf("Expected a new hash for changed content")
+	}
+}
+
+func TestOpenRemovesOtherVersions(t *testing.T) {
+	dir := t.TempDir()
+	// versions are removed once none of their manifests was written for a
+	// while, a server of the other version may still be running
+	version := func(name string, written time.Time) string {
+		roots := filepath.Join(dir, name, "roots")
+		if err := os.MkdirAll(roots, 0700); err != nil {
+			t.Fatalf("Error creating directory: %s", err)
+		}
+		writeFile(t, filepath.Join(roots, "root.json"), "{}")
+		for _, path := range []string{filepath.Join(roots, "root.json"), roots, filepath.Join(dir, name)} {
+			if err := os.Chtimes(path, written, written); err != nil {
+				t.Fatalf("Error changing times: %s", err)
+			}
+		}
+
+		return filepath.Join(dir, name)
+	}
+	stale := version("v0-0", time.Now().AddDate(0, -2, 0))
+	running := version("v0-1", time.Now())
+	other := filepath.Join(dir, "vscode")
+	if err := os.MkdirAll(other, 0700); err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+
+	if _, err := indexcache.Open(dir, t.TempDir()); err != nil {
+		t.Fatalf("Error opening cache: %s", err)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale cache of another version to be removed, got %v", err)
+	}
+	if _, err := os.Stat(running); err != nil {
+		t.Errorf("Expected the cache of another version written lately to be kept, got %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Expected directories that are not a version to be kept, got %v", err)
+	}
+}
+
+func TestFlushRemovesSymbolsNoManifestRefersTo(t *testing.T) {
+	dir := t.TempDir()
+	root := t.TempDir()
+	symbols := []treesitter.Symbol{{Name: "Foo", Kind: treesitter.Kind_Class}}
+
+	cache, err := indexcache.Open(dir, root)
+	if err != nil {
+		t.Fatalf("Error opening cache: %s", err)
+	}
+
+	store := func(cache *indexcache.Cache, path string, content string) string {
+		info := writeFile(t, filepath.Join(root, path), content)
+		hash := cache.Key(path, info, []byte(content))
+		if err := cache.StoreSymbols(hash, treesitter.ModeFull, symbols); err != nil {
+			t.Fatalf("Error storing symbols: %s", err)
+		}
+		cache.Remember(path, info, hash)
+		if err := cache.Flush(); err != nil {
+			t.Fatalf("Error flushing cache: %s", err)
+		}
+
+		return hash
+	}
+
+	first := store(cache, "a.php", "<?php\nclass Foo {}")
+	shared := store(cache, "b.php", "<?php\nclass Shared {}")
+
+	// another root still refers to the shared content
+	other, err := indexcache.Open(dir, t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening cache: %s", err)
+	}
+	info, _ := os.Stat(filepath.Join(root, "b.php"))
+	other.Remember("b.php", info, shared)
+	if err := other.Flush(); err != nil {
+		t.Fatalf("Error flushing cache: %s", err)
+	}
+
+	reopened, err := indexcache.Open(dir, root)
+	if err != nil {
+		t.Fatalf("Error opening cache: %s", err)
+	}
+	second := store(reopened, "a.php", "<?php\nclass Changed {}")
+
+	tests := map[string]struct {
+		hash     string
+		expected bool
+	}{
+		"changed content":         {first, false},
+		"new content":             {second, true},
+		"content of another root": {shared, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := reopened.Symbols(tt.hash, treesitter.ModeFull); ok != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, ok)
+			}
+		})
+	}
+}
@@ -1,28 +1,219 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 )
 
-var logger *log.Logger
+type Level int
 
-func GetLogger() *log.Logger {
-	if logger == nil {
-		return log.New(os.Stdout, "[PHP-LSP] ", log.Ldate|log.Ltime|log.Lshortfile)
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+var levelNames = map[Level]string{
+	LevelError: "error",
+	LevelWarn:  "warn",
+	LevelInfo:  "info",
+	LevelDebug: "debug",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
 	}
-	return logger
+
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected one of error, warn, info or debug", name)
+}
+
+type Options struct {
+	// Path of the log file, DefaultPath() when empty.
+	Path  string
+	Level Level
+	// MaxSize is the size in bytes at which the log file is rotated, zero
+	// disables rotation.
+	MaxSize int64
+	// MaxBackups is how many rotated files are kept.
+	MaxBackups int
 }
 
-func SetLogger(l *log.Logger) {
-	logger = l
+// Hook receives every message logged at a level enabled for it.
+type Hook func(level Level, message string)
+
+// Logger writes to the output of the package and forwards warnings and
+// errors to its own hooks. A server has one for its session, so only the
+// messages of that session reach its client. A nil Logger is the default
+// one used by the functions of the package.
+type Logger struct {
+	mu       sync.RWMutex
+	hooks    map[int]Hook
+	nextHook int
+}
+
+func New() *Logger {
+	return &Logger{hooks: map[int]Hook{}}
+}
+
+var (
+	mu     sync.RWMutex
+	level              = LevelInfo
+	output *log.Logger = log.New(os.Stderr, "[PHP-LSP] ", log.Ldate|log.Ltime)
+	std                = New()
+)
+
+// DefaultPath is a log file only readable by the current user, logs contain
+// the source code of the project.
+func DefaultPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "php-lsp-server", "php-lsp-server.log")
 }
 
-func CreateLogFile(logFile string) *log.Logger {
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+// Setup sends the logs to the file described by options.
+func Setup(options Options) error {
+	path := options.Path
+	if path == "" {
+		path = DefaultPath()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := openRotatingFile(path, options.MaxSize, options.MaxBackups)
 	if err != nil {
-		panic("Failed to open log file")
+		return err
+	}
+
+	SetOutput(file, options.Level)
+
+	return nil
+}
+
+// SetOutput sends the logs at lvl and below to w.
+func SetOutput(w io.Writer, lvl Level) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	output = log.New(w, "[PHP-LSP] ", log.Ldate|log.Ltime)
+	level = lvl
+}
+
+// Enabled tells whether messages at lvl are written, callers can skip
+// building expensive messages when they are not.
+func Enabled(lvl Level) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return lvl <= level
+}
+
+// AddHook registers a hook for warnings and errors of the default logger
+// and returns a function removing it.
+func AddHook(hook Hook) func() {
+	return std.AddHook(hook)
+}
+
+// AddHook registers a hook for warnings and errors and returns a function
+// removing it.
+func (l *Logger) AddHook(hook Hook) func() {
+	if l == nil {
+		l = std
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := l.nextHook
+	l.nextHook++
+	l.hooks[id] = hook
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		delete(l.hooks, id)
+	}
+}
+
+func (l *Logger) logf(lvl Level, format string, args ...any) {
+	if l == nil {
+		l = std
+	}
+
+	mu.RLock()
+	enabled := lvl <= level
+	out := output
+	mu.RUnlock()
+
+	var forward []Hook
+	if lvl <= LevelWarn {
+		l.mu.RLock()
+		for _, hook := range l.hooks {
+			forward = append(forward, hook)
+		}
+		l.mu.RUnlock()
+	}
+
+	if !enabled && len(forward) == 0 {
+		return
+	}
+
+	message := fmt.Sprintf(format, args...)
+	if enabled {
+		out.Printf("%-5s %s", strings.ToUpper(lvl.String()), message)
 	}
 
-	return log.New(file, "[PHP-LSP] ", log.Ldate|log.Ltime|log.Lshortfile)
+	for _, hook := range forward {
+		hook(lvl, message)
+	}
+}
+
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(LevelError, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(LevelWarn, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(LevelInfo, format, args...)
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(LevelDebug, format, args...)
+}
+
+func Errorf(format string, args ...any) {
+	std.logf(LevelError, format, args...)
+}
+
+func Warnf(format string, args ...any) {
+	std.logf(LevelWarn, format, args...)
+}
+
+func Infof(format string, args ...any) {
+	std.logf(LevelInfo, format, args...)
+}
+
+func Debugf(format string, args ...any) {
+	std.logf(LevelDebug, format, args...)
 }
@@ -0,0 +1,129 @@
+package logger_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	tests := map[string]struct {
+		level    logger.Level
+		expected []string
+	}{
+		"error": {level: logger.LevelError, expected: []string{"ERROR"}},
+		"info":  {level: logger.LevelInfo, expected: []string{"ERROR", "WARN", "INFO"}},
+		"debug": {level: logger.LevelDebug, expected: []string{"ERROR", "WARN", "INFO", "DEBUG"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var output bytes.Buffer
+			logger.SetOutput(&output, test.level)
+			defer logger.SetOutput(os.Stderr, logger.LevelInfo)
+
+			logger.Errorf("message")
+			logger.Warnf("message")
+			logger.Infof("message")
+			logger.Debugf("message")
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			if len(lines) != len(test.expected) {
+				t.Fatalf("Expected %d lines, got %d: %s", len(test.expected), len(lines), output.String())
+			}
+
+			for i, level := range test.expected {
+				if !strings.Contains(lines[i], level+" ") {
+					t.Errorf("Expected %v, got %v", level, lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHooksReceiveWarningsAndErrors(t *testing.T) {
+	logger.SetOutput(&bytes.Buffer{}, logger.LevelError)
+	defer logger.SetOutput(os.Stderr, logger.LevelInfo)
+
+	received := []string{}
+	remove := logger.AddHook(func(level logger.Level, message string) {
+		received = append(received, level.String()+": "+message)
+	})
+
+	logger.Errorf("first %d", 1)
+	logger.Warnf("second")
+	logger.Infof("third")
+	remove()
+	logger.Errorf("fourth")
+
+	expected := []string{"error: first 1", "warn: second"}
+	if strings.Join(received, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, received)
+	}
+}
+
+func TestLoggersOnlyForwardTheirOwnMessages(t *testing.T) {
+	logger.SetOutput(&bytes.Buffer{}, logger.LevelError)
+	defer logger.SetOutput(os.Stderr, logger.LevelInfo)
+
+	first, second := logger.New(), logger.New()
+	received := []string{}
+	defer first.AddHook(func(level logger.Level, message string) {
+		received = append(received, message)
+	})()
+
+	first.Warnf("mine")
+	second.Warnf("other session")
+	logger.Warnf("default")
+
+	expected := []string{"mine"}
+	if strings.Join(received, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, received)
+	}
+}
+
+func TestSetupRotatesLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "server.log")
+
+	err := logger.Setup(logger.Options{Path: path, Level: logger.LevelInfo, MaxSize: 100, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("Error setting up logger: %s", err)
+	}
+	defer logger.SetOutput(os.Stderr, logger.LevelInfo)
+
+	for i := 0; i < 10; i++ {
+		logger.Infof("a message long enough to fill the log file")
+	}
+
+	for _, file := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %s", file, err)
+		}
+
+		if info.Size() > 100 {
+			t.Errorf("Expected %s to be at most 100 bytes, got %d", file, info.Size())
+		}
+
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected %s to be private, got %v", file, info.Mode().Perm())
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("Expected at most 2 backups")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := logger.ParseLevel("DEBUG"); err != nil || level != logger.LevelDebug {
+		t.Errorf("Expected %v, got %v (%v)", logger.LevelDebug, level, err)
+	}
+
+	if _, err := logger.ParseLevel("verbose"); err == nil {
+		t.Errorf("Expected an error for an unknown level")
+	}
+}
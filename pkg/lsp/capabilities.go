@@ -0,0 +1,169 @@
+package lsp
+
+// ClientCapabilities describes what the client supports, a missing field
+// means the feature is not supported.
+type ClientCapabilities struct {
+	Workspace    WorkspaceClientCapabilities    `json:"workspace"`
+	TextDocument TextDocumentClientCapabilities `json:"textDocument"`
+	Window       WindowClientCapabilities       `json:"window"`
+	General      *GeneralClientCapabilities     `json:"general,omitempty"`
+}
+
+type WorkspaceClientCapabilities struct {
+	ApplyEdit              bool                        `json:"applyEdit"`
+	WorkspaceFolders       bool                        `json:"workspaceFolders"`
+	Configuration          bool                        `json:"configuration"`
+	DidChangeConfiguration DynamicRegistration         `json:"didChangeConfiguration"`
+	DidChangeWatchedFiles  DidChangeWatchedFilesClient `json:"didChangeWatchedFiles"`
+	Symbol                 WorkspaceSymbolClient       `json:"symbol"`
+	ExecuteCommand         DynamicRegistration         `json:"executeCommand"`
+}
+
+type DynamicRegistration struct {
+	DynamicRegistration bool `json:"dynamicRegistration"`
+}
+
+type DidChangeWatchedFilesClient struct {
+	DynamicRegistration    bool `json:"dynamicRegistration"`
+	RelativePatternSupport bool `json:"relativePatternSupport"`
+}
+
+type WorkspaceSymbolClient struct {
+	DynamicRegistration bool           `json:"dynamicRegistration"`
+	SymbolKind          *ValueSet[int] `json:"symbolKind,omitempty"`
+}
+
+// ValueSet lists the values of an enumeration the client knows about.
+type ValueSet[T any] struct {
+	ValueSet []T `json:"valueSet"`
+}
+
+type TextDocumentClientCapabilities struct {
+	Synchronization TextDocumentSyncClient `json:"synchronization"`
+	Completion      CompletionClient       `json:"completion"`
+	Hover           HoverClient            `json:"hover"`
+	DocumentSymbol  DocumentSymbolClient   `json:"documentSymbol"`
+}
+
+type TextDocumentSyncClient struct {
+	DynamicRegistration bool `json:"dynamicRegistration"`
+	WillSave            bool `json:"willSave"`
+	WillSaveWaitUntil   bool `json:"willSaveWaitUntil"`
+	DidSave             bool `json:"didSave"`
+}
+
+type CompletionClient struct {
+	DynamicRegistration bool                 `json:"dynamicRegistration"`
+	CompletionItem      CompletionItemClient `json:"completionItem"`
+	CompletionItemKind  *ValueSet[int]       `json:"completionItemKind,omitempty"`
+	ContextSupport      bool                 `json:"contextSupport"`
+}
+
+type CompletionItemClient struct {
+	SnippetSupport          bool     `json:"snippetSupport"`
+	CommitCharactersSupport bool     `json:"commitCharactersSupport"`
+	DocumentationFormat     []string `json:"documentationFormat"`
+	DeprecatedSupport       bool     `json:"deprecatedSupport"`
+	PreselectSupport        bool     `json:"preselectSupport"`
+	LabelDetailsSupport     bool     `json:"labelDetailsSupport"`
+}
+
+type HoverClient struct {
+	DynamicRegistration bool     `json:"dynamicRegistration"`
+	ContentFormat       []string `json:"contentFormat"`
+}
+
+type DocumentSymbolClient struct {
+	DynamicRegistration               bool           `json:"dynamicRegistration"`
+	SymbolKind                        *ValueSet[int] `json:"symbolKind,omitempty"`
+	HierarchicalDocumentSymbolSupport bool           `json:"hierarchicalDocumentSymbolSupport"`
+}
+
+type WindowClientCapabilities struct {
+	WorkDoneProgress bool `json:"workDoneProgress"`
+	ShowDocument     struct {
+		Support bool `json:"support"`
+	} `json:"showDocument"`
+}
+
+type GeneralClientCapabilities struct {
+	// PositionEncodings lists the encodings the client supports, in order
+	// of preference. UTF-16 is always supported even if omitted.
+	PositionEncodings []string `json:"positionEncodings,omitempty"`
+}
+
+const (
+	MarkupKindPlainText = "plaintext"
+	MarkupKindMarkdown  = "markdown"
+)
+
+// defaultSymbolKinds are the kinds every client supports, File up to Array.
+const defaultSymbolKindMax = 18
+
+// defaultCompletionItemKindMax is the last completion kind every client
+// supports, Text up to Reference.
+const defaultCompletionItemKindMax = 18
+
+// SymbolKind returns kind if the client supports it for document symbols,
+// or a kind close to it that every client knows.
+func (c ClientCapabilities) SymbolKind(kind int) int {
+	return supportedSymbolKind(c.TextDocument.DocumentSymbol.SymbolKind, kind)
+}
+
+// WorkspaceSymbolKind is SymbolKind for workspace symbols.
+func (c ClientCapabilities) WorkspaceSymbolKind(kind int) int {
+	return supportedSymbolKind(c.Workspace.Symbol.SymbolKind, kind)
+}
+
+func supportedSymbolKind(supported *ValueSet[int], kind int) int {
+	if supported == nil {
+		if kind <= defaultSymbolKindMax {
+			return kind
+		}
+	} else {
+		for _, value := range supported.ValueSet {
+			if value == kind {
+				return kind
+			}
+		}
+	}
+
+	switch kind {
+	case SymbolKindEnumMember:
+		return SymbolKindConstant
+	default:
+		return SymbolKindClass
+	}
+}
+
+// CompletionItemKind returns kind if the client supports it, Text otherwise.
+func (c ClientCapabilities) CompletionItemKind(kind int) int {
+	supported := c.TextDocument.Completion.CompletionItemKind
+	if supported == nil {
+		if kind <= defaultCompletionItemKindMax {
+			return kind
+		}
+
+		return Symbol_Kind_Text
+	}
+
+	for _, value := range supported.ValueSet {
+		if value == kind {
+			return kind
+		}
+	}
+
+	return Symbol_Kind_Text
+}
+
+// DocumentationFormat returns the markup kind to use for completion
+// documentation, markdown when the client renders it.
+func (c ClientCapabilities) DocumentationFormat() string {
+	for _, format := range c.TextDocument.Completion.CompletionItem.DocumentationFormat {
+		if format == MarkupKindMarkdown {
+			return MarkupKindMarkdown
+		}
+	}
+
+	return MarkupKindPlainText
+}
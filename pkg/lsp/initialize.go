@@ -1,14 +1,40 @@
 package lsp
 
+import "encoding/json"
+
 type InitializeRequest struct {
 	Request
 	Params InitializeRequestParams `json:"params"`
 }
 
 type InitializeRequestParams struct {
+	ProcessID  *int        `json:"processId"` // is null if the server was not started by another process
 	ClientInfo *ClientInfo `json:"clientInfo"`
 	RootPath   string      `json:"rootPath"` // is null if no folder is open
 	RootUri    string      `json:"rootUri"`  // is null if no folder is open
+	Trace      string      `json:"trace"`    // off, messages or verbose
+	// WorkspaceFolders supersede rootUri and rootPath when the client
+	// supports them, null if no folder is open
+	WorkspaceFolders []WorkspaceFolder `json:"workspaceFolders"`
+
+	Capabilities          ClientCapabilities `json:"capabilities"`
+	InitializationOptions json.RawMessage    `json:"initializationOptions,omitempty"`
+}
+
+// NegotiatePositionEncoding picks the position encoding to use with a client,
+// UTF-8 when it supports it as it is what the server works with natively.
+func NegotiatePositionEncoding(capabilities ClientCapabilities) string {
+	if capabilities.General == nil {
+		return DefaultPositionEncoding
+	}
+
+	for _, encoding := range capabilities.General.PositionEncodings {
+		if encoding == PositionEncodingUTF8 {
+			return PositionEncodingUTF8
+		}
+	}
+
+	return DefaultPositionEncoding
 }
 
 type ClientInfo struct {
@@ -27,11 +53,30 @@ type InitializeResult struct {
 }
 
 type ServerCapabilities struct {
-	TextDocumentSync        int            `json:"textDocumentSync"`
-	CompletionProvider      map[string]any `json:"completionProvider"`
-	DocumentSymbolProvider  bool           `json:"documentSymbolProvider"`
-	WorkspaceSymbolProvider bool           `json:"workspaceSymbolProvider"`
-	Window                  Window         `json:"window"`
+	PositionEncoding        string                      `json:"positionEncoding,omitempty"`
+	TextDocumentSync        TextDocumentSyncOptions     `json:"textDocumentSync"`
+	CompletionProvider      map[string]any              `json:"completionProvider"`
+	DocumentSymbolProvider  bool                        `json:"documentSymbolProvider"`
+	WorkspaceSymbolProvider bool                        `json:"workspaceSymbolProvider"`
+	Window                  Window                      `json:"window"`
+	Workspace               WorkspaceServerCapabilities `json:"workspace"`
+	ExecuteCommandProvider  *ExecuteCommandOptions      `json:"executeCommandProvider,omitempty"`
+}
+
+const (
+	TextDocumentSyncKindNone        = 0
+	TextDocumentSyncKindFull        = 1
+	TextDocumentSyncKindIncremental = 2
+)
+
+type TextDocumentSyncOptions struct {
+	OpenClose bool         `json:"openClose"`
+	Change    int          `json:"change"`
+	Save      *SaveOptions `json:"save,omitempty"`
+}
+
+type SaveOptions struct {
+	IncludeText bool `json:"includeText"`
 }
 
 type Window struct {
@@ -43,7 +88,7 @@ type ServerInfo struct {
 	Version string `json:"version"`
 }
 
-func NewInitializeResponse(id int) InitializeResponse {
+func NewInitializeResponse(id ID, positionEncoding string) InitializeResponse {
 	return InitializeResponse{
 		Response: Response{
 			RPC: "2.0",
@@ -51,13 +96,26 @@ func NewInitializeResponse(id int) InitializeResponse {
 		},
 		Result: InitializeResult{
 			Capabilities: ServerCapabilities{
-				TextDocumentSync:        1, // Full sync
+				PositionEncoding: positionEncoding,
+				TextDocumentSync: TextDocumentSyncOptions{
+					OpenClose: true,
+					Change:    TextDocumentSyncKindIncremental,
+					Save: &SaveOptions{
+						IncludeText: true,
+					},
+				},
 				CompletionProvider:      map[string]any{},
 				DocumentSymbolProvider:  true,
 				WorkspaceSymbolProvider: true,
 				Window: Window{
 					WorkDoneProgress: true,
 				},
+				Workspace: WorkspaceServerCapabilities{
+					WorkspaceFolders: WorkspaceFoldersServerCapabilities{
+						Supported:           true,
+						ChangeNotifications: true,
+					},
+				},
 			},
 			ServerInfo: ServerInfo{
 				Name:    "PHP Language Server",
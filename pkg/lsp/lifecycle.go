@@ -0,0 +1,28 @@
+package lsp
+
+type InitializedNotification struct {
+	Notification
+}
+
+type ShutdownRequest struct {
+	Request
+}
+
+type ShutdownResponse struct {
+	Response
+	Result any `json:"result"`
+}
+
+func NewShutdownResponse(id ID) ShutdownResponse {
+	return ShutdownResponse{
+		Response: Response{
+			RPC: "2.0",
+			ID:  id,
+		},
+		Result: nil,
+	}
+}
+
+type ExitNotification struct {
+	Notification
+}
@@ -1,17 +1,175 @@
 package lsp
 
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ID identifies a request, JSON-RPC allows both numbers and strings. The zero
+// ID is null, which is what responses to unidentifiable requests carry.
+type ID struct {
+	value any // nil, int64 or string
+}
+
+func NewIntID(id int) ID {
+	return ID{value: int64(id)}
+}
+
+func NewStringID(id string) ID {
+	return ID{value: id}
+}
+
+func (id ID) IsNull() bool {
+	return id.value == nil
+}
+
+func (id ID) String() string {
+	switch v := id.value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return strconv.Quote(v)
+	}
+
+	return "null"
+}
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(id.value)
+}
+
+func (id *ID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		id.value = nil
+		return nil
+	}
+
+	var number int64
+	if err := json.Unmarshal(data, &number); err == nil {
+		id.value = number
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		id.value = str
+		return nil
+	}
+
+	return errors.New("id must be a number or a string")
+}
+
+// Message is a message the server writes, it tells its method and id
+// without encoding it. Request, Response and Notification implement it for
+// the messages embedding them.
+type Message interface {
+	// Header returns the method of the message, empty for responses, and its
+	// id, nil for notifications.
+	Header() (method string, id *ID)
+}
+
 type Request struct {
 	RPC    string `json:"jsonrpc"`
-	ID     int    `json:"id"`
+	ID     ID     `json:"id"`
 	Method string `json:"method"`
 }
 
+// RequestMessage is a request the server sends to the client.
+type RequestMessage struct {
+	Request
+	Params any `json:"params,omitempty"`
+}
+
+func NewRequest(id ID, method string, params any) RequestMessage {
+	return RequestMessage{
+		Request: Request{
+			RPC:    "2.0",
+			ID:     id,
+			Method: method,
+		},
+		Params: params,
+	}
+}
+
+func (r Request) Header() (string, *ID) {
+	return r.Method, &r.ID
+}
+
 type Response struct {
 	RPC string `json:"jsonrpc"`
-	ID  int    `json:"id,omitempty"`
+	ID  ID     `json:"id"`
+}
+
+func (r Response) Header() (string, *ID) {
+	return "", &r.ID
 }
 
 type Notification struct {
 	RPC    string `json:"jsonrpc"`
 	Method string `json:"method"`
 }
+
+func (n Notification) Header() (string, *ID) {
+	return n.Method, nil
+}
+
+// NotificationMessage is a notification the server sends to the client.
+type NotificationMessage struct {
+	Notification
+	Params any `json:"params,omitempty"`
+}
+
+func NewNotification(method string, params any) NotificationMessage {
+	return NotificationMessage{
+		Notification: Notification{
+			RPC:    "2.0",
+			Method: method,
+		},
+		Params: params,
+	}
+}
+
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+
+	ServerNotInitialized = -32002
+	UnknownErrorCode     = -32001
+
+	RequestFailed    = -32803
+	ServerCancelled  = -32802
+	ContentModified  = -32801
+	RequestCancelled = -32800
+)
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *ResponseError) Error() string {
+	return e.Message
+}
+
+type ErrorResponse struct {
+	Response
+	Error ResponseError `json:"error"`
+}
+
+func NewErrorResponse(id ID, code int, message string) ErrorResponse {
+	return ErrorResponse{
+		Response: Response{
+			RPC: "2.0",
+			ID:  id,
+		},
+		Error: ResponseError{
+			Code:    code,
+			Message: message,
+		},
+	}
+}
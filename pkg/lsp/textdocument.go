@@ -12,6 +12,16 @@ type TextDocumentPositionParams struct {
 	Position     Position               `json:"position"`
 }
 
+const (
+	PositionEncodingUTF8  = "utf-8"
+	PositionEncodingUTF16 = "utf-16"
+	PositionEncodingUTF32 = "utf-32"
+)
+
+// DefaultPositionEncoding is used when the client does not negotiate one,
+// every client has to support it.
+const DefaultPositionEncoding = PositionEncodingUTF16
+
 type Position struct {
 	Line      int `json:"line"`
 	Character int `json:"character"`
@@ -20,3 +30,8 @@ type Position struct {
 type TextDocumentIdentifier struct {
 	Uri string `json:"uri"`
 }
+
+type VersionedTextDocumentIdentifier struct {
+	Uri     string `json:"uri"`
+	Version int    `json:"version"`
+}
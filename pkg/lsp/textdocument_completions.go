@@ -42,9 +42,31 @@ type CompletionResponse struct {
 	Result []CompletionItem `json:"result"`
 }
 
+const (
+	InsertTextFormatPlainText = 1
+	InsertTextFormatSnippet   = 2
+)
+
 type CompletionItem struct {
-	Label         string `json:"label"`
-	Kind          int    `json:"kind"`
-	Detail        string `json:"detail,omitempty"`
-	Documentation string `json:"documentation,omitempty"`
+	Label            string         `json:"label"`
+	Kind             int            `json:"kind"`
+	Detail           string         `json:"detail,omitempty"`
+	Documentation    *MarkupContent `json:"documentation,omitempty"`
+	InsertText       string         `json:"insertText,omitempty"`
+	InsertTextFormat int            `json:"insertTextFormat,omitempty"`
+}
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// NewCodeDocumentation documents a PHP declaration in the given markup kind,
+// as a highlighted code block for clients rendering markdown.
+func NewCodeDocumentation(kind string, code string) *MarkupContent {
+	if kind == MarkupKindMarkdown {
+		return &MarkupContent{Kind: MarkupKindMarkdown, Value: "```php\n<?php\n" + code + "\n```"}
+	}
+
+	return &MarkupContent{Kind: MarkupKindPlainText, Value: code}
 }
@@ -6,7 +6,7 @@ type DidChangeTextDocumentNotification struct {
 }
 
 type DidChangeTextDocumentParamsParams struct {
-	TextDocument   TextDocumentIdentifier           `json:"textDocument"`
+	TextDocument   VersionedTextDocumentIdentifier  `json:"textDocument"`
 	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
 }
 
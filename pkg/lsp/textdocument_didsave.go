@@ -0,0 +1,12 @@
+package lsp
+
+type DidSaveTextDocumentNotification struct {
+	Notification
+	Params DidSaveTextDocumentParams `json:"params"`
+}
+
+type DidSaveTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	// Text is only sent when the server asked for it with includeText
+	Text *string `json:"text,omitempty"`
+}
@@ -1,5 +1,13 @@
 package lsp
 
+// symbol kinds the server falls back to for clients that do not know the
+// kind of a symbol
+const (
+	SymbolKindClass      = 5
+	SymbolKindConstant   = 14
+	SymbolKindEnumMember = 22
+)
+
 type DocumentSymbolRequest struct {
 	Request
 	Params DocumentSymbolParams `json:"params"`
@@ -24,6 +32,21 @@ type DocumentSymbol struct {
 	Children       []DocumentSymbol `json:"children,omitempty"`
 }
 
+// SymbolInformationResponse answers documentSymbol for clients without
+// hierarchicalDocumentSymbolSupport, symbols are a flat list.
+type SymbolInformationResponse struct {
+	Response
+	Result []SymbolInformation `json:"result"`
+}
+
+type SymbolInformation struct {
+	Name          string   `json:"name"`
+	Kind          int      `json:"kind"`
+	Deprecated    bool     `json:"deprecated,omitempty"`
+	Location      Location `json:"location"`
+	ContainerName string   `json:"containerName,omitempty"`
+}
+
 type Range struct {
 	Start Position `json:"start"`
 	End   Position `json:"end"`
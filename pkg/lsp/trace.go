@@ -0,0 +1,39 @@
+package lsp
+
+const (
+	TraceOff      = "off"
+	TraceMessages = "messages"
+	TraceVerbose  = "verbose"
+)
+
+type SetTraceNotification struct {
+	Notification
+	Params SetTraceParams `json:"params"`
+}
+
+type SetTraceParams struct {
+	Value string `json:"value"`
+}
+
+type LogTraceNotification struct {
+	Notification
+	Params LogTraceParams `json:"params"`
+}
+
+type LogTraceParams struct {
+	Message string `json:"message"`
+	Verbose string `json:"verbose,omitempty"`
+}
+
+func NewLogTraceNotification(message string, verbose string) LogTraceNotification {
+	return LogTraceNotification{
+		Notification: Notification{
+			RPC:    "2.0",
+			Method: "$/logTrace",
+		},
+		Params: LogTraceParams{
+			Message: message,
+			Verbose: verbose,
+		},
+	}
+}
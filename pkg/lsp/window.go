@@ -0,0 +1,66 @@
+package lsp
+
+type MessageType int
+
+const (
+	MessageTypeError   MessageType = 1
+	MessageTypeWarning MessageType = 2
+	MessageTypeInfo    MessageType = 3
+	MessageTypeLog     MessageType = 4
+)
+
+type LogMessageNotification struct {
+	Notification
+	Params LogMessageParams `json:"params"`
+}
+
+type LogMessageParams struct {
+	Type    MessageType `json:"type"`
+	Message string      `json:"message"`
+}
+
+func NewLogMessageNotification(messageType MessageType, message string) LogMessageNotification {
+	return LogMessageNotification{
+		Notification: Notification{
+			RPC:    "2.0",
+			Method: "window/logMessage",
+		},
+		Params: LogMessageParams{
+			Type:    messageType,
+			Message: message,
+		},
+	}
+}
+
+type ShowMessageNotification struct {
+	Notification
+	Params ShowMessageParams `json:"params"`
+}
+
+type ShowMessageParams struct {
+	Type    MessageType `json:"type"`
+	Message string      `json:"message"`
+}
+
+func NewShowMessageNotification(messageType MessageType, message string) ShowMessageNotification {
+	return ShowMessageNotification{
+		Notification: Notification{
+			RPC:    "2.0",
+			Method: "window/showMessage",
+		},
+		Params: ShowMessageParams{
+			Type:    messageType,
+			Message: message,
+		},
+	}
+}
+
+type ShowMessageRequestParams struct {
+	Type    MessageType         `json:"type"`
+	Message string              `json:"message"`
+	Actions []MessageActionItem `json:"actions,omitempty"`
+}
+
+type MessageActionItem struct {
+	Title string `json:"title"`
+}
@@ -1,5 +1,22 @@
 package lsp
 
+// WorkDoneProgressCreateParams asks the client to create a progress token
+// with window/workDoneProgress/create before it is used.
+type WorkDoneProgressCreateParams struct {
+	Token string `json:"token"`
+}
+
+// WorkDoneProgressCancelNotification asks the server to stop the work of a
+// cancellable progress.
+type WorkDoneProgressCancelNotification struct {
+	Notification
+	Params WorkDoneProgressCancelParams `json:"params"`
+}
+
+type WorkDoneProgressCancelParams struct {
+	Token string `json:"token"`
+}
+
 type WorkDoneProgressBeginRequest struct {
 	Notification
 	Params WorkDoneProgressBeginParams `json:"params"`
@@ -50,7 +67,7 @@ type WorkDoneProgressEndParamsValue struct {
 	Message string `json:"message"`
 }
 
-func CreateProgressBeginRequest(token string, title string) WorkDoneProgressBeginRequest {
+func CreateProgressBeginRequest(token string, title string, cancellable bool) WorkDoneProgressBeginRequest {
 	return WorkDoneProgressBeginRequest{
 		Notification: Notification{
 			RPC:    "2.0",
@@ -61,7 +78,7 @@ func CreateProgressBeginRequest(token string, title string) WorkDoneProgressBegi
 			Values: WorkDoneProgressBeginParamsValue{
 				Kind:        "begin",
 				Title:       title,
-				Cancellable: false,
+				Cancellable: cancellable,
 				Percentage:  0,
 				Message:     "",
 			},
@@ -69,7 +86,7 @@ func CreateProgressBeginRequest(token string, title string) WorkDoneProgressBegi
 	}
 }
 
-func CreateProgressUpdateRequest(token string, message string, percentage int) WorkDoneProgressReportRequest {
+func CreateProgressUpdateRequest(token string, message string, percentage int, cancellable bool) WorkDoneProgressReportRequest {
 	return WorkDoneProgressReportRequest{
 		Notification: Notification{
 			RPC:    "2.0",
@@ -79,7 +96,7 @@ func CreateProgressUpdateRequest(token string, message string, percentage int) W
 			Token: token,
 			Values: WorkDoneProgressReportParamsValue{
 				Kind:        "report",
-				Cancellable: false,
+				Cancellable: cancellable,
 				Percentage:  percentage,
 				Message:     message,
 			},
@@ -0,0 +1,10 @@
+package lsp
+
+type ConfigurationParams struct {
+	Items []ConfigurationItem `json:"items"`
+}
+
+type ConfigurationItem struct {
+	ScopeUri string `json:"scopeUri,omitempty"`
+	Section  string `json:"section,omitempty"`
+}
@@ -0,0 +1,39 @@
+package lsp
+
+const (
+	FileChangeCreated = 1
+	FileChangeChanged = 2
+	FileChangeDeleted = 3
+)
+
+const (
+	WatchKindCreate = 1
+	WatchKindChange = 2
+	WatchKindDelete = 4
+)
+
+type DidChangeWatchedFilesNotification struct {
+	Notification
+	Params DidChangeWatchedFilesParams `json:"params"`
+}
+
+type DidChangeWatchedFilesParams struct {
+	Changes []FileEvent `json:"changes"`
+}
+
+type FileEvent struct {
+	Uri  string `json:"uri"`
+	Type int    `json:"type"`
+}
+
+// DidChangeWatchedFilesRegistrationOptions are the registerOptions of a
+// workspace/didChangeWatchedFiles registration.
+type DidChangeWatchedFilesRegistrationOptions struct {
+	Watchers []FileSystemWatcher `json:"watchers"`
+}
+
+type FileSystemWatcher struct {
+	GlobPattern string `json:"globPattern"`
+	// Kind is a combination of WatchKind values, all of them when zero.
+	Kind int `json:"kind,omitempty"`
+}
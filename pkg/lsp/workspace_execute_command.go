@@ -0,0 +1,33 @@
+package lsp
+
+import "encoding/json"
+
+type ExecuteCommandRequest struct {
+	Request
+	Params ExecuteCommandParams `json:"params"`
+}
+
+type ExecuteCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+// ExecuteCommandOptions lists the commands the server executes.
+type ExecuteCommandOptions struct {
+	Commands []string `json:"commands"`
+}
+
+type ExecuteCommandResponse struct {
+	Response
+	Result any `json:"result"`
+}
+
+func NewExecuteCommandResponse(id ID) ExecuteCommandResponse {
+	return ExecuteCommandResponse{
+		Response: Response{
+			RPC: "2.0",
+			ID:  id,
+		},
+		Result: nil,
+	}
+}
@@ -15,9 +15,10 @@ type WorkspaceSymbolResponse struct {
 }
 
 type WorkSpaceSymbol struct {
-	Name     string   `json:"name"`
-	Kind     int      `json:"kind"`
-	Location Location `json:"location"`
+	Name          string   `json:"name"`
+	Kind          int      `json:"kind"`
+	ContainerName string   `json:"containerName,omitempty"`
+	Location      Location `json:"location"`
 }
 
 type Location struct {
@@ -6,54 +6,169 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
+var headerSeparator = []byte{'\r', '\n', '\r', '\n'}
+
+// ErrBatch is returned for JSON-RPC batches, LSP does not use them.
+var ErrBatch = errors.New("batch messages are not supported")
+
 func EncodeMessage(message any) string {
 	content, err := json.Marshal(message)
 	if err != nil {
 		panic(err)
 	}
 
+	return EncodeContent(content)
+}
+
+// EncodeContent frames the JSON content of a message with its header.
+func EncodeContent(content []byte) string {
 	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(content), content)
 }
 
+// BaseMessage holds the fields every JSON-RPC message may have, enough to
+// tell requests, notifications and responses apart.
 type BaseMessage struct {
-	Method string `json:"method"`
+	RPC    string          `json:"jsonrpc"`
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// HasID tells whether the message carries a non null id.
+func (m BaseMessage) HasID() bool {
+	return len(m.ID) > 0 && string(m.ID) != "null"
+}
+
+// IsRequest tells whether the message expects a response.
+func (m BaseMessage) IsRequest() bool {
+	return m.Method != "" && m.HasID()
+}
+
+// IsNotification tells whether the message is a method call without an id.
+func (m BaseMessage) IsNotification() bool {
+	return m.Method != "" && !m.HasID()
+}
+
+// IsResponse tells whether the message answers a request we sent.
+func (m BaseMessage) IsResponse() bool {
+	return m.Method == "" && (len(m.Result) > 0 || len(m.Error) > 0)
+}
+
+// ParseError is returned when the content of a message is not valid JSON.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid message content: %s", e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseHeaders parses the header part of a message. Header names are case
+// insensitive, Content-Length is required and Content-Type is optional.
+func ParseHeaders(header []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+
+	for _, line := range strings.Split(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("malformed header: %q", line)
+		}
+
+		headers[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	return headers, nil
+}
+
+func contentLength(header []byte) (int, error) {
+	headers, err := ParseHeaders(header)
+	if err != nil {
+		return 0, err
+	}
+
+	value, ok := headers["content-length"]
+	if !ok {
+		return 0, errors.New("missing Content-Length header")
+	}
+
+	length, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Content-Length header: %w", err)
+	}
+
+	if length < 0 {
+		return 0, fmt.Errorf("invalid Content-Length header: %d", length)
+	}
+
+	return length, nil
 }
 
+// DecodeMessage returns the method and the content of a framed message. A
+// content that is not valid JSON is reported with a *ParseError, so it can be
+// told apart from broken framing.
 func DecodeMessage(msg []byte) (string, []byte, error) {
-	header, content, found := bytes.Cut(msg, []byte{'\r', '\n', '\r', '\n'})
+	header, content, found := bytes.Cut(msg, headerSeparator)
 	if !found {
 		return "", nil, errors.New("Did not find separator")
 	}
 
-	// Content-Length: <number>
-	contentLengthBytes := header[len("Content-Length: "):]
-	contentLength, err := strconv.Atoi(string(contentLengthBytes))
+	contentLength, err := contentLength(header)
 	if err != nil {
 		return "", nil, err
 	}
 
+	if len(content) < contentLength {
+		return "", nil, errors.New("Content is shorter than its Content-Length")
+	}
+	content = content[:contentLength]
+
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+		return "", content, ErrBatch
+	}
+
 	var baseMessage BaseMessage
-	if err := json.Unmarshal(content[:contentLength], &baseMessage); err != nil {
-		return "", nil, err
+	if err := json.Unmarshal(content, &baseMessage); err != nil {
+		return "", content, &ParseError{Err: err}
+	}
+
+	return baseMessage.Method, content, nil
+}
+
+// Parse classifies the content of a decoded message.
+func Parse(content []byte) (BaseMessage, error) {
+	var baseMessage BaseMessage
+	if err := json.Unmarshal(content, &baseMessage); err != nil {
+		return baseMessage, &ParseError{Err: err}
 	}
 
-	return baseMessage.Method, content[:contentLength], nil
+	return baseMessage, nil
 }
 
-// type SplitFunc func(data []byte, atEOF bool) (advance int, token []byte, err error)
-func Split(data []byte, _ bool) (advance int, token []byte, err error) {
-	header, content, found := bytes.Cut(data, []byte{'\r', '\n', '\r', '\n'})
+// Split is a bufio.SplitFunc returning one framed message at a time. A
+// malformed header does not stop the scanner: everything up to the next
+// Content-Length header is returned as a token DecodeMessage rejects, so
+// the message is lost but the following ones are still read.
+func Split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	header, content, found := bytes.Cut(data, headerSeparator)
 	if !found {
 		return 0, nil, nil
 	}
 
-	// Content-Length: <number>
-	contentLengthBytes := header[len("Content-Length: "):]
-	contentLength, err := strconv.Atoi(string(contentLengthBytes))
+	contentLength, err := contentLength(header)
 	if err != nil {
-		return 0, nil, err
+		return resync(data, atEOF)
 	}
 
 	if len(content) < contentLength {
@@ -63,3 +178,19 @@ func Split(data []byte, _ bool) (advance int, token []byte, err error) {
 	totalLength := len(header) + 4 + contentLength
 	return totalLength, data[:totalLength], nil
 }
+
+var contentLengthHeader = []byte("content-length")
+
+// resync skips the malformed start of data up to the next Content-Length
+// header, the start of the next message.
+func resync(data []byte, atEOF bool) (int, []byte, error) {
+	next := bytes.Index(bytes.ToLower(data[1:]), contentLengthHeader)
+	if next < 0 {
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+
+	return next + 1, data[:next+1], nil
+}
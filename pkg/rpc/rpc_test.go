@@ -35,3 +35,120 @@ func TestDecodeMessage(t *testing.T) {
 		t.Errorf("Expected content length 15, got %d", contentlen)
 	}
 }
+
+func TestDecodeMessageHeaders(t *testing.T) {
+	tests := map[string]struct {
+		message string
+		method  string
+		err     bool
+	}{
+		"content type after length": {
+			message: "Content-Length: 15\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n{\"Method\":\"hi\"}",
+			method:  "hi",
+		},
+		"content type before length": {
+			message: "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\nContent-Length: 15\r\n\r\n{\"Method\":\"hi\"}",
+			method:  "hi",
+		},
+		"header names are case insensitive": {
+			message: "content-length: 15\r\n\r\n{\"Method\":\"hi\"}",
+			method:  "hi",
+		},
+		"missing content length": {
+			message: "Content-Type: application/vscode-jsonrpc\r\n\r\n{\"Method\":\"hi\"}",
+			err:     true,
+		},
+		"invalid json": {
+			message: "Content-Length: 5\r\n\r\n{\"Met",
+			err:     true,
+		},
+		"batch": {
+			message: "Content-Length: 17\r\n\r\n[{\"Method\":\"hi\"}]",
+			err:     true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			method, _, err := rpc.DecodeMessage([]byte(tt.message))
+			if tt.err != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+
+			if method != tt.method {
+				t.Errorf("Expected method %s, got %s", tt.method, method)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	first := "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\nContent-Length: 15\r\n\r\n{\"Method\":\"hi\"}"
+	second := "Content-Length: 16\r\n\r\n{\"Method\":\"bye\"}"
+
+	advance, token, err := rpc.Split([]byte(first+second), false)
+	if err != nil {
+		t.Fatalf("Error splitting messages: %s", err)
+	}
+
+	if advance != len(first) || string(token) != first {
+		t.Errorf("Expected first message %q, got %q", first, token)
+	}
+
+	advance, _, _ = rpc.Split([]byte(second[:20]), false)
+	if advance != 0 {
+		t.Errorf("Expected to wait for the rest of an incomplete message, got advance %d", advance)
+	}
+}
+
+func TestSplitSkipsMalformedHeaders(t *testing.T) {
+	malformed := "Content-Length: abc\r\n\r\n{\"Method\":\"hi\"}"
+	second := "Content-Length: 16\r\n\r\n{\"Method\":\"bye\"}"
+
+	advance, token, err := rpc.Split([]byte(malformed+second), false)
+	if err != nil {
+		t.Fatalf("Error splitting messages: %s", err)
+	}
+
+	if advance != len(malformed) || string(token) != malformed {
+		t.Errorf("Expected the malformed message %q, got %q", malformed, token)
+	}
+
+	if _, _, err := rpc.DecodeMessage(token); err == nil {
+		t.Errorf("Expected the malformed message to be rejected")
+	}
+
+	advance, token, _ = rpc.Split([]byte(second), false)
+	if advance != len(second) || string(token) != second {
+		t.Errorf("Expected second message %q, got %q", second, token)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		content      string
+		request      bool
+		notification bool
+		response     bool
+	}{
+		"request with a number id":  {`{"jsonrpc":"2.0","id":1,"method":"shutdown"}`, true, false, false},
+		"request with a string id":  {`{"jsonrpc":"2.0","id":"a","method":"shutdown"}`, true, false, false},
+		"notification":              {`{"jsonrpc":"2.0","method":"exit"}`, false, true, false},
+		"response":                  {`{"jsonrpc":"2.0","id":1,"result":null}`, false, false, true},
+		"error response with no id": {`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error"}}`, false, false, true},
+		"notification with null id": {`{"jsonrpc":"2.0","id":null,"method":"exit"}`, false, true, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			message, err := rpc.Parse([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("Error parsing message: %s", err)
+			}
+
+			if message.IsRequest() != tt.request || message.IsNotification() != tt.notification || message.IsResponse() != tt.response {
+				t.Errorf("Expected request %v, notification %v and response %v for %s", tt.request, tt.notification, tt.response, tt.content)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/rpc"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// callTimeout bounds how long the server waits for the client to answer one
+// of its requests, a client may never answer one it does not support.
+const callTimeout = 30 * time.Second
+
+// ErrServerStopped is returned by Call when the server stops before the
+// client answered.
+var ErrServerStopped = errors.New("server stopped")
+
+// Call sends a request to the client and waits for its response, decoding
+// the result into result unless it is nil. An error response is returned as
+// a *lsp.ResponseError.
+//
+// The response is read by the read loop, so Call must not be used from the
+// handlers of sequential methods, it would wait for itself.
+func (s *Server) Call(ctx context.Context, method string, params any, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	s.mu.Lock()
+	s.lastCallID++
+	id := lsp.NewIntID(s.lastCallID)
+	responses := make(chan rpc.BaseMessage, 1)
+	s.calls[id] = responses
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.calls, id)
+		s.mu.Unlock()
+	}()
+
+	s.writer.Write(lsp.NewRequest(id, method, params))
+
+	var response rpc.BaseMessage
+	select {
+	case response = <-responses:
+	case <-ctx.Done():
+		// let the client stop working on an answer nobody waits for
+		s.Notify("$/cancelRequest", lsp.CancelParams{ID: id})
+		return fmt.Errorf("%s request %s: %w", method, id, ctx.Err())
+	case <-s.ctx.Done():
+		return fmt.Errorf("%s request %s: %w", method, id, ErrServerStopped)
+	}
+
+	if len(response.Error) > 0 && string(response.Error) != "null" {
+		var responseError lsp.ResponseError
+		if err := json.Unmarshal(response.Error, &responseError); err != nil {
+			return fmt.Errorf("%s request %s: invalid error: %w", method, id, err)
+		}
+
+		return &responseError
+	}
+
+	if result == nil || len(response.Result) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("%s request %s: invalid result: %w", method, id, err)
+	}
+
+	return nil
+}
+
+// Notify sends a notification to the client.
+func (s *Server) Notify(method string, params any) {
+	s.writer.Write(lsp.NewNotification(method, params))
+}
+
+// resolve hands a response of the client to the Call waiting for it.
+func (s *Server) resolve(message rpc.BaseMessage) {
+	var id lsp.ID
+	if err := json.Unmarshal(message.ID, &id); err != nil {
+		s.log.Warnf("Invalid id in response: %s", message.ID)
+		return
+	}
+
+	s.mu.Lock()
+	responses, ok := s.calls[id]
+	s.mu.Unlock()
+
+	if !ok {
+		logger.Debugf("Ignoring response to unknown request %s", id)
+		return
+	}
+
+	select {
+	case responses <- message:
+	default:
+		logger.Debugf("Ignoring duplicate response to request %s", id)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"ahmedash95/php-lsp-server/pkg/fileuri"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"path/filepath"
+)
+
+// workspaceFolders returns the folders the client opened, from the
+// deprecated rootUri and rootPath when it does not support several.
+func workspaceFolders(params lsp.InitializeRequestParams) []lsp.WorkspaceFolder {
+	if params.WorkspaceFolders != nil {
+		return params.WorkspaceFolders
+	}
+
+	uri := params.RootUri
+	if uri == "" && params.RootPath != "" {
+		uri = fileuri.FromPath(params.RootPath)
+	}
+
+	if uri == "" {
+		return nil
+	}
+
+	return []lsp.WorkspaceFolder{{Uri: uri, Name: filepath.Base(fileuri.ToPath(uri))}}
+}
+
+// folderPath returns the path of a workspace folder with symlinks resolved,
+// like the paths of the files indexed in it.
+func folderPath(folder lsp.WorkspaceFolder) string {
+	return fileuri.CanonicalPath(fileuri.ToPath(folder.Uri))
+}
@@ -0,0 +1,500 @@
+package server
+
+import (
+	"ahmedash95/php-lsp-server/pkg/config"
+	"ahmedash95/php-lsp-server/pkg/fileuri"
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/workspace"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// configurationSection is the section of the client settings holding those
+// of the server, asked for each workspace folder.
+const configurationSection = "php-lsp"
+
+// reindexCommand is the command of workspace/executeCommand indexing every
+// folder again.
+const reindexCommand = "php-lsp.reindex"
+
+func (s *Server) handleMessage(ctx context.Context, id *lsp.ID, method string, contents []byte) {
+	logger.Debugf("Received message: [%s]", method)
+
+	switch method {
+	case "initialize":
+		var request lsp.InitializeRequest
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		s.setTrace(request.Params.Trace)
+		s.workspace.PositionEncoding = lsp.NegotiatePositionEncoding(request.Params.Capabilities)
+		s.workspace.Capabilities = request.Params.Capabilities
+
+		config, err := config.Decode(request.Params.InitializationOptions)
+		if err != nil {
+			s.log.Warnf("Ignoring invalid initializationOptions: %s", err)
+		}
+		s.workspace.Config = config
+
+		for _, folder := range workspaceFolders(request.Params) {
+			logger.Infof("Initializing workspace folder: %s", folder.Uri)
+			s.workspace.AddFolder(folder.Name, folderPath(folder), config)
+		}
+
+		message := lsp.NewInitializeResponse(request.ID, s.workspace.PositionEncoding)
+		message.Result.Capabilities.ExecuteCommandProvider = &lsp.ExecuteCommandOptions{Commands: []string{reindexCommand}}
+		s.writer.Write(message)
+		s.setState(stateInitialized)
+
+		if request.Params.ProcessID != nil {
+			go s.watchParentProcess(*request.Params.ProcessID)
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.index()
+		}()
+	case "initialized":
+		logger.Infof("Client initialized")
+
+	case "shutdown":
+		var request lsp.ShutdownRequest
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		// stop background work and let in-flight requests finish before
+		// telling the client it is safe to exit
+		s.setState(stateShuttingDown)
+		s.stopFn()
+		s.wg.Wait()
+
+		s.writer.Write(lsp.NewShutdownResponse(request.ID))
+
+	case "exit":
+		s.mu.Lock()
+		code := 1
+		if s.state == stateShuttingDown {
+			code = 0
+		}
+		s.mu.Unlock()
+
+		logger.Infof("Exiting with code %d", code)
+		s.stop(code)
+
+	case "textDocument/didOpen":
+		var request lsp.DidOpenTextDocumentNotification
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		document := request.Params.TextDocument
+		s.workspace.Open(fileuri.Canonical(document.Uri), document.Version, document.Text)
+		logger.Debugf("Opened file: %s", document.Uri)
+
+	case "textDocument/didChange":
+		var request lsp.DidChangeTextDocumentNotification
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		document := request.Params.TextDocument
+		s.workspace.Update(fileuri.Canonical(document.Uri), document.Version, request.Params.ContentChanges)
+		logger.Debugf("Changed file: %s", document.Uri)
+
+	case "textDocument/didClose":
+		var request lsp.DidCloseTextDocumentNotification
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		s.workspace.Close(fileuri.Canonical(request.Params.TextDocument.Uri))
+		logger.Debugf("Closed file: %s", request.Params.TextDocument.Uri)
+
+	case "textDocument/didSave":
+		var request lsp.DidSaveTextDocumentNotification
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		s.workspace.Save(fileuri.Canonical(request.Params.TextDocument.Uri), request.Params.Text)
+		logger.Debugf("Saved file: %s", request.Params.TextDocument.Uri)
+
+	case "workspace/didChangeWatchedFiles":
+		var request lsp.DidChangeWatchedFilesNotification
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		for i, change := range request.Params.Changes {
+			request.Params.Changes[i].Uri = fileuri.Canonical(change.Uri)
+		}
+		s.filesChanged(request.Params.Changes)
+
+	case "workspace/didChangeWorkspaceFolders":
+		var request lsp.DidChangeWorkspaceFoldersNotification
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		for _, folder := range request.Params.Event.Removed {
+			logger.Infof("Removing workspace folder: %s", folder.Uri)
+			s.workspace.RemoveFolder(folderPath(folder))
+		}
+
+		var added []*workspace.Folder
+		for _, folder := range request.Params.Event.Added {
+			logger.Infof("Adding workspace folder: %s", folder.Uri)
+			added = append(added, s.workspace.AddFolder(folder.Name, folderPath(folder), s.workspace.Config))
+		}
+
+		if len(added) > 0 {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.indexFolders(added)
+			}()
+		}
+
+	case "window/workDoneProgress/cancel":
+		var request lsp.WorkDoneProgressCancelNotification
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		s.mu.Lock()
+		run, ok := s.indexing[request.Params.Token]
+		s.mu.Unlock()
+
+		if ok {
+			logger.Infof("Indexing cancelled by the client")
+			run.cancel()
+		}
+
+	case "workspace/executeCommand":
+		var request lsp.ExecuteCommandRequest
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		if request.Params.Command != reindexCommand {
+			s.writer.Write(lsp.NewErrorResponse(request.ID, lsp.InvalidParams, "Unknown command: "+request.Params.Command))
+			return
+		}
+
+		s.reindex()
+		s.reply(ctx, request.ID, lsp.NewExecuteCommandResponse(request.ID))
+
+	case "$/setTrace":
+		var request lsp.SetTraceNotification
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		s.setTrace(request.Params.Value)
+
+	case "textDocument/documentSymbol":
+		var request lsp.DocumentSymbolRequest
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		uri := fileuri.Canonical(request.Params.TextDocument.Uri)
+		if !s.workspace.Capabilities.TextDocument.DocumentSymbol.HierarchicalDocumentSymbolSupport {
+			response := s.workspace.TextDocumentSymbolInformation(request.ID, uri)
+			s.reply(ctx, request.ID, response)
+			return
+		}
+
+		response := s.workspace.TextDocumentDocumentSymbols(request.ID, uri)
+		s.reply(ctx, request.ID, response)
+	case "workspace/symbol":
+		var request lsp.WorkspaceSymbolRequest
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		response := s.workspace.WorkspaceSymbols(ctx, request.ID, request.Params.Query)
+		s.reply(ctx, request.ID, response)
+
+	case "textDocument/completion":
+		var request lsp.CompletionRequest
+		if !s.decode(id, method, contents, &request) {
+			return
+		}
+
+		params := request.Params.TextDocumentPositionParams
+		params.TextDocument.Uri = fileuri.Canonical(params.TextDocument.Uri)
+		response := s.workspace.TextDocumentCompletion(request.ID, params)
+		s.reply(ctx, request.ID, response)
+
+	default:
+		if id != nil {
+			s.writer.Write(lsp.NewErrorResponse(*id, lsp.MethodNotFound, "Method not found: "+method))
+			return
+		}
+
+		logger.Debugf("Ignoring notification: [%s]", method)
+	}
+}
+
+// filesChanged queues watched file changes for the index. A checkout may
+// change thousands of files, they are read and parsed off the read loop by
+// a single goroutine handling the batches in the order they arrived.
+func (s *Server) filesChanged(changes []lsp.FileEvent) {
+	s.watchedMu.Lock()
+	defer s.watchedMu.Unlock()
+
+	s.watched = append(s.watched, changes)
+	if s.draining {
+		return
+	}
+	s.draining = true
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			s.watchedMu.Lock()
+			if len(s.watched) == 0 {
+				s.draining = false
+				s.watchedMu.Unlock()
+				return
+			}
+			changes := s.watched[0]
+			s.watched = s.watched[1:]
+			s.watchedMu.Unlock()
+
+			s.workspace.FilesChanged(changes)
+			logger.Debugf("Changed %d watched files", len(changes))
+		}
+	}()
+}
+
+// index scans the workspace in the background and reports its progress to
+// the client, when it supports progress. The index is then kept up to date
+// with the files changed outside the editor.
+func (s *Server) index() {
+	// watchers are registered first so changes made while indexing are not
+	// missed
+	watching := s.registerWatchers()
+
+	s.mu.Lock()
+	s.watching = watching
+	s.mu.Unlock()
+
+	s.indexFolders(s.workspace.Folders())
+}
+
+// indexFolders applies the settings of each folder, indexes them and then
+// polls them for changes when the client does not watch files. It returns
+// once the folders are removed or the server stops.
+func (s *Server) indexFolders(folders []*workspace.Folder) {
+	folders = s.configureFolders(folders)
+	s.indexWorkspace(s.startIndex(), folders, false)
+
+	s.mu.Lock()
+	watching := s.watching
+	s.mu.Unlock()
+
+	if watching {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, folder := range folders {
+		interval := folder.Config.Indexing.PollInterval
+		if interval <= 0 {
+			continue
+		}
+
+		logger.Infof("Polling %s for changed files every %d seconds", folder.Path, interval)
+		wg.Add(1)
+		go func(folder *workspace.Folder) {
+			defer wg.Done()
+			s.workspace.Poll(s.ctx, folder, time.Duration(interval)*time.Second)
+		}(folder)
+	}
+	wg.Wait()
+}
+
+// registerWatchers asks the client to notify the changes of the files the
+// index depends on, it tells whether the client will.
+func (s *Server) registerWatchers() bool {
+	if !s.workspace.Capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration {
+		return false
+	}
+
+	watchers := make([]lsp.FileSystemWatcher, 0, len(workspace.WatchedFiles))
+	for _, pattern := range workspace.WatchedFiles {
+		watchers = append(watchers, lsp.FileSystemWatcher{GlobPattern: pattern})
+	}
+
+	params := lsp.RegistrationParams{
+		Registrations: []lsp.Registration{{
+			ID:              "watched-files",
+			Method:          "workspace/didChangeWatchedFiles",
+			RegisterOptions: lsp.DidChangeWatchedFilesRegistrationOptions{Watchers: watchers},
+		}},
+	}
+	if err := s.Call(s.ctx, "client/registerCapability", params, nil); err != nil {
+		logger.Infof("Client does not watch files: %s", err)
+		return false
+	}
+
+	return true
+}
+
+// configureFolders asks the client for the settings of each folder, in the
+// php-lsp section, and applies them over those of initializationOptions.
+func (s *Server) configureFolders(folders []*workspace.Folder) []*workspace.Folder {
+	if !s.workspace.Capabilities.Workspace.Configuration || len(folders) == 0 {
+		return folders
+	}
+
+	params := lsp.ConfigurationParams{}
+	for _, folder := range folders {
+		params.Items = append(params.Items, lsp.ConfigurationItem{
+			ScopeUri: fileuri.FromPath(folder.Path),
+			Section:  configurationSection,
+		})
+	}
+
+	var settings []json.RawMessage
+	if err := s.Call(s.ctx, "workspace/configuration", params, &settings); err != nil {
+		logger.Infof("Using the initializationOptions for every folder: %s", err)
+		return folders
+	}
+
+	configured := make([]*workspace.Folder, 0, len(folders))
+	for i, folder := range folders {
+		if i >= len(settings) {
+			configured = append(configured, folder)
+			continue
+		}
+
+		cfg, err := s.workspace.Config.Merge(settings[i])
+		if err != nil {
+			s.log.Warnf("Ignoring invalid settings of %s: %s", folder.Path, err)
+		}
+		configured = append(configured, s.workspace.AddFolder(folder.Name, folder.Path, cfg))
+	}
+
+	return configured
+}
+
+// reindex stops the indexes still running and indexes every folder again in
+// the background, with the settings the client has now. The new index
+// starts once the stopped ones are done, they use the same caches.
+func (s *Server) reindex() {
+	s.mu.Lock()
+	var stopped []chan struct{}
+	for _, run := range s.indexing {
+		run.cancel()
+		stopped = append(stopped, run.done)
+	}
+	s.mu.Unlock()
+
+	// registered right away so a following reindex stops this one too
+	run := s.startIndex()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for _, done := range stopped {
+			<-done
+		}
+		s.indexWorkspace(run, s.configureFolders(s.workspace.Folders()), true)
+	}()
+}
+
+// indexRun is an index started by the server, token is that of its
+// progress and done is closed once it returned.
+type indexRun struct {
+	token  string
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startIndex registers a new index, indexWorkspace runs it.
+func (s *Server) startIndex() *indexRun {
+	ctx, cancel := context.WithCancel(s.ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastProgress++
+	run := &indexRun{
+		token:  fmt.Sprintf("indexing-%d", s.lastProgress),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.indexing[run.token] = run
+
+	return run
+}
+
+// indexWorkspace runs the index run over folders, replacing the files
+// already indexed when replace is set. Its progress is reported to the
+// client when it supports it, the client can then cancel it.
+func (s *Server) indexWorkspace(run *indexRun, folders []*workspace.Folder, replace bool) {
+	ctx, token := run.ctx, run.token
+	defer func() {
+		run.cancel()
+
+		s.mu.Lock()
+		delete(s.indexing, token)
+		s.mu.Unlock()
+
+		close(run.done)
+	}()
+
+	index := s.workspace.Index
+	if replace {
+		index = s.workspace.Reindex
+	}
+
+	if !s.workspace.Capabilities.Window.WorkDoneProgress {
+		index(ctx, folders, func(workspace.Progress) {}, func() {})
+		return
+	}
+
+	// the client only accepts progress on tokens it created
+	err := s.Call(ctx, "window/workDoneProgress/create", lsp.WorkDoneProgressCreateParams{Token: token}, nil)
+	if err != nil {
+		logger.Infof("Indexing without progress: %s", err)
+		index(ctx, folders, func(workspace.Progress) {}, func() {})
+		return
+	}
+
+	s.writer.Write(lsp.CreateProgressBeginRequest(token, "Indexing workspace", true))
+
+	update := func(progress workspace.Progress) {
+		s.writer.Write(lsp.CreateProgressUpdateRequest(token, progressMessage(progress), progress.Percentage(), true))
+	}
+	index(ctx, folders, update, func() {
+		message := "Indexing complete"
+		if ctx.Err() != nil {
+			message = "Indexing cancelled"
+		}
+		s.writer.Write(lsp.CreateProgressEndRequest(token, message))
+	})
+}
+
+// progressMessage tells how many files are indexed and the directory of the
+// last one.
+func progressMessage(progress workspace.Progress) string {
+	dir := filepath.ToSlash(filepath.Join(progress.Folder, filepath.Dir(progress.File)))
+	return fmt.Sprintf("indexed %d/%d files (%s)", progress.Indexed, progress.Total, dir)
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"errors"
+	"net"
+)
+
+// ServeListener accepts connections on l until it is closed and serves every
+// connection as its own session, with its own workspace.
+func ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		go ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single session over conn and closes it once the client
+// exits or goes away.
+func ServeConn(conn net.Conn) int {
+	defer conn.Close()
+
+	logger.Infof("Session started: %s", conn.RemoteAddr())
+
+	code := NewServer(conn).Serve(conn)
+
+	logger.Infof("Session ended: %s with code %d", conn.RemoteAddr(), code)
+
+	return code
+}
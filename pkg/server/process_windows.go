@@ -0,0 +1,25 @@
+//go:build windows
+
+package server
+
+import (
+	"syscall"
+)
+
+const processQueryLimitedInformation = 0x1000
+const stillActive = 259
+
+func processAlive(pid int) bool {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return false
+	}
+
+	return code == stillActive
+}
@@ -0,0 +1,395 @@
+package server
+
+import (
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/rpc"
+	"ahmedash95/php-lsp-server/pkg/workspace"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// maxMessageSize is the biggest message the scanner accepts. didOpen and
+// full didChange notifications carry whole files so the default 64KB of
+// bufio.Scanner is not enough.
+const maxMessageSize = 64 * 1024 * 1024
+
+// sequentialMethods are handled on the read loop itself, in the order they
+// arrive, so every request that comes after them sees their effect.
+var sequentialMethods = map[string]bool{
+	"initialize":                          true,
+	"initialized":                         true,
+	"shutdown":                            true,
+	"exit":                                true,
+	"textDocument/didOpen":                true,
+	"textDocument/didChange":              true,
+	"textDocument/didClose":               true,
+	"textDocument/didSave":                true,
+	"$/setTrace":                          true,
+	"workspace/didChangeWatchedFiles":     true,
+	"workspace/didChangeWorkspaceFolders": true,
+}
+
+type state int
+
+const (
+	stateUninitialized state = iota
+	stateInitialized
+	stateShuttingDown
+)
+
+type Server struct {
+	workspace *workspace.Workspace
+	writer    *writer
+
+	// mu guards state, exitCode, trace, pending, the cancel functions of
+	// in-flight requests by id, calls, the requests sent to the client
+	// waiting for a response, watching, whether the client watches files
+	// for the server, lastProgress, the last progress token used, and
+	// indexing, the running indexes by token.
+	mu           sync.Mutex
+	state        state
+	exitCode     int
+	trace        string
+	pending      map[lsp.ID]context.CancelFunc
+	calls        map[lsp.ID]chan rpc.BaseMessage
+	lastCallID   int
+	watching     bool
+	lastProgress int
+	indexing     map[string]*indexRun
+
+	// ctx is cancelled when the server shuts down, background work such as
+	// indexing stops with it.
+	ctx    context.Context
+	stopFn context.CancelFunc
+
+	// done is closed once the server must stop serving, either because the
+	// client sent exit or because the editor process died.
+	done     chan struct{}
+	doneOnce sync.Once
+
+	// watchedMu guards watched, the batches of changed files the index did
+	// not handle yet, and draining, whether a goroutine is handling them.
+	watchedMu sync.Mutex
+	watched   [][]lsp.FileEvent
+	draining  bool
+
+	// log forwards the warnings and errors of the session to the client,
+	// only those of this server.
+	log *logger.Logger
+
+	// workers limits how many requests are handled at the same time.
+	workers chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewServer(w io.Writer) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	log := logger.New()
+
+	s := &Server{
+		workspace: workspace.NewWorkspace(""),
+		writer:    &writer{w: w, log: log},
+		trace:     lsp.TraceOff,
+		pending:   make(map[lsp.ID]context.CancelFunc),
+		calls:     make(map[lsp.ID]chan rpc.BaseMessage),
+		indexing:  make(map[string]*indexRun),
+		ctx:       ctx,
+		stopFn:    cancel,
+		done:      make(chan struct{}),
+		workers:   make(chan struct{}, runtime.NumCPU()),
+		log:       log,
+	}
+	s.writer.sent = s.traceSent
+	s.workspace.Client = s
+	s.workspace.Log = log
+
+	return s
+}
+
+// Serve reads messages from r and dispatches them until the client sends
+// exit, the stream is closed or the editor process dies. It returns the
+// status code the process should exit with.
+func (s *Server) Serve(r io.Reader) int {
+	removeHook := s.log.AddHook(s.forwardLog)
+	defer removeHook()
+
+	messages := make(chan []byte)
+	go s.read(r, messages)
+
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				// the client went away without asking us to exit
+				s.stop(1)
+				return s.wait()
+			}
+
+			_, contents, err := rpc.DecodeMessage(msg)
+			if err != nil {
+				s.rejectMessage(err)
+				continue
+			}
+
+			s.dispatch(contents)
+		case <-s.done:
+			return s.wait()
+		}
+	}
+}
+
+// wait blocks until in-flight work is done and returns the exit code.
+func (s *Server) wait() int {
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.exitCode
+}
+
+func (s *Server) read(r io.Reader, messages chan<- []byte) {
+	defer close(messages)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	scanner.Split(rpc.Split)
+
+	for scanner.Scan() {
+		// the scanner reuses its buffer, handlers may outlive this iteration
+		msg := append([]byte(nil), scanner.Bytes()...)
+
+		select {
+		case messages <- msg:
+		case <-s.done:
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		s.log.Errorf("Error reading messages: %s", err)
+	}
+}
+
+// stop makes Serve return with the given exit code.
+func (s *Server) stop(code int) {
+	s.doneOnce.Do(func() {
+		s.mu.Lock()
+		s.exitCode = code
+		s.mu.Unlock()
+
+		s.stopFn()
+		close(s.done)
+	})
+}
+
+// rejectMessage answers a message that could not be decoded. Errors in the
+// framing itself cannot be answered, the message is lost.
+func (s *Server) rejectMessage(err error) {
+	logger.Infof("Error decoding message: %s", err)
+
+	var parseError *rpc.ParseError
+	switch {
+	case errors.As(err, &parseError):
+		response := lsp.NewErrorResponse(lsp.ID{}, lsp.ParseError, "Parse error")
+		response.Error.Data = parseError.Err.Error()
+		s.writer.Write(response)
+	case errors.Is(err, rpc.ErrBatch):
+		response := lsp.NewErrorResponse(lsp.ID{}, lsp.InvalidRequest, "Invalid request")
+		response.Error.Data = err.Error()
+		s.writer.Write(response)
+	}
+}
+
+func (s *Server) dispatch(contents []byte) {
+	message, err := rpc.Parse(contents)
+	if err != nil {
+		s.rejectMessage(err)
+		return
+	}
+
+	s.traceReceived(message, contents)
+
+	if message.IsResponse() {
+		s.resolve(message)
+		return
+	}
+
+	var id *lsp.ID
+	if message.HasID() {
+		id = &lsp.ID{}
+		if err := json.Unmarshal(message.ID, id); err != nil {
+			response := lsp.NewErrorResponse(lsp.ID{}, lsp.InvalidRequest, "Invalid request")
+			response.Error.Data = err.Error()
+			s.writer.Write(response)
+			return
+		}
+	}
+
+	if message.RPC != "2.0" || message.Method == "" {
+		logger.Infof("Invalid message: %s", contents)
+		if id != nil {
+			s.writer.Write(lsp.NewErrorResponse(*id, lsp.InvalidRequest, "Invalid request"))
+		}
+		return
+	}
+
+	method := message.Method
+	if code, errorMessage, ok := s.allowed(method); !ok {
+		logger.Debugf("Rejecting message [%s]: %s", method, errorMessage)
+		if id != nil {
+			s.writer.Write(lsp.NewErrorResponse(*id, code, errorMessage))
+		}
+		return
+	}
+
+	if method == "$/cancelRequest" {
+		var notification lsp.CancelRequestNotification
+		if err := json.Unmarshal(contents, &notification); err != nil {
+			s.log.Warnf("Error unmarshalling cancel request: %s", err)
+			return
+		}
+
+		s.cancel(notification.Params.ID)
+		return
+	}
+
+	if sequentialMethods[method] {
+		s.handle(context.Background(), id, method, contents)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if id != nil {
+		s.track(*id, cancel)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+
+		if id != nil {
+			defer s.untrack(*id)
+		}
+
+		s.workers <- struct{}{}
+		defer func() { <-s.workers }()
+
+		s.handle(ctx, id, method, contents)
+	}()
+}
+
+// allowed tells whether method may be handled in the current lifecycle
+// state, and the error to answer with when it may not.
+func (s *Server) allowed(method string) (int, string, bool) {
+	if method == "exit" {
+		return 0, "", true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case stateUninitialized:
+		if method != "initialize" {
+			return lsp.ServerNotInitialized, "Server is not initialized", false
+		}
+	case stateInitialized:
+		if method == "initialize" {
+			return lsp.InvalidRequest, "Server is already initialized", false
+		}
+	case stateShuttingDown:
+		return lsp.InvalidRequest, "Server is shutting down", false
+	}
+
+	return 0, "", true
+}
+
+func (s *Server) setState(state state) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = state
+}
+
+// handle runs a single message handler, a panic in one handler must not take
+// the whole server down. id is nil for notifications.
+func (s *Server) handle(ctx context.Context, id *lsp.ID, method string, contents []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.Errorf("Recovered in %s: %v\nstacktrace from panic: \n%s", method, r, debug.Stack())
+			s.showMessage(lsp.MessageTypeError, fmt.Sprintf("PHP LSP failed to handle %s, see the log file for details", method))
+
+			if id != nil {
+				s.writer.Write(lsp.NewErrorResponse(*id, lsp.InternalError, fmt.Sprintf("Internal error: %v", r)))
+			}
+		}
+	}()
+
+	s.handleMessage(ctx, id, method, contents)
+}
+
+// decode unmarshals the content of a message into request. Requests with
+// params that do not match are answered with InvalidParams.
+func (s *Server) decode(id *lsp.ID, method string, contents []byte, request any) bool {
+	err := json.Unmarshal(contents, request)
+	if err == nil {
+		return true
+	}
+
+	logger.Infof("Error unmarshalling %s request: %s", method, err)
+	if id != nil {
+		response := lsp.NewErrorResponse(*id, lsp.InvalidParams, "Invalid params")
+		response.Error.Data = err.Error()
+		s.writer.Write(response)
+	}
+
+	return false
+}
+
+func (s *Server) track(id lsp.ID, cancel context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending[id] = cancel
+}
+
+func (s *Server) untrack(id lsp.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, id)
+}
+
+func (s *Server) cancel(id lsp.ID) {
+	s.mu.Lock()
+	cancel, ok := s.pending[id]
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	logger.Debugf("Cancelling request: %s", id)
+	cancel()
+}
+
+// reply writes the response of request id, or a RequestCancelled error when
+// the client cancelled it while it was being handled.
+func (s *Server) reply(ctx context.Context, id lsp.ID, response lsp.Message) {
+	if ctx.Err() != nil {
+		s.writer.Write(lsp.NewErrorResponse(id, lsp.RequestCancelled, "Request cancelled"))
+		return
+	}
+
+	s.writer.Write(response)
+}
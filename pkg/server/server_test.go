@@ -0,0 +1,939 @@
+package server_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/rpc"
+	"ahmedash95/php-lsp-server/pkg/server"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// keep the index cache of the tests away from the one of the user
+	cache, err := os.MkdirTemp("", "php-lsp-server-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CACHE_HOME", cache)
+	os.Setenv("HOME", cache)
+
+	code := m.Run()
+	os.RemoveAll(cache)
+	os.Exit(code)
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func encode(messages ...string) *strings.Reader {
+	var input strings.Builder
+	for _, message := range messages {
+		input.WriteString(rpc.EncodeMessage(json.RawMessage(message)))
+	}
+
+	return strings.NewReader(input.String())
+}
+
+func decode(t *testing.T, output []byte) []map[string]any {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Split(rpc.Split)
+
+	messages := []map[string]any{}
+	for scanner.Scan() {
+		_, content, err := rpc.DecodeMessage(scanner.Bytes())
+		if err != nil {
+			t.Fatalf("Error decoding message: %s", err)
+		}
+
+		var message map[string]any
+		if err := json.Unmarshal(content, &message); err != nil {
+			t.Fatalf("Error unmarshalling message: %s", err)
+		}
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+func initialize(t *testing.T) string {
+	return `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootPath":"` + t.TempDir() + `"}}`
+}
+
+func response(messages []map[string]any, id float64) map[string]any {
+	for _, message := range messages {
+		if message["id"] == id {
+			return message
+		}
+	}
+
+	return nil
+}
+
+func TestServeAnswersRequestsAfterDocumentChanges(t *testing.T) {
+	input := encode(
+		initialize(t),
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.php","languageId":"php","version":1,"text":"<?php\nclass Foo {}"}}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"file:///a.php","version":2},"contentChanges":[{"range":{"start":{"line":1,"character":6},"end":{"line":1,"character":9}},"text":"Bar"}]}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"file:///a.php"}}}`,
+		`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":42}}`,
+	)
+
+	output := &syncBuffer{}
+	server.NewServer(output).Serve(input)
+
+	message := response(decode(t, output.buf.Bytes()), 7)
+	if message == nil {
+		t.Fatalf("Expected a response to request 7")
+	}
+
+	symbols := message["result"].([]any)
+	if len(symbols) != 1 || symbols[0].(map[string]any)["name"] != "Bar" {
+		t.Errorf("Expected the symbols of the changed document, got %v", symbols)
+	}
+}
+
+func TestServeLifecycle(t *testing.T) {
+	tests := map[string]struct {
+		messages []string
+		code     int
+		errors   map[float64]float64
+	}{
+		"requests before initialize are rejected": {
+			messages: []string{
+				`{"jsonrpc":"2.0","id":3,"method":"workspace/symbol","params":{"query":""}}`,
+				`{"jsonrpc":"2.0","method":"exit"}`,
+			},
+			code:   1,
+			errors: map[float64]float64{3: -32002},
+		},
+		"exit after shutdown succeeds": {
+			messages: []string{
+				initialize(t),
+				`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+				`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+				`{"jsonrpc":"2.0","id":3,"method":"workspace/symbol","params":{"query":""}}`,
+				`{"jsonrpc":"2.0","method":"exit"}`,
+			},
+			code:   0,
+			errors: map[float64]float64{3: -32600},
+		},
+		"exit without shutdown fails": {
+			messages: []string{
+				initialize(t),
+				`{"jsonrpc":"2.0","method":"exit"}`,
+			},
+			code:   1,
+			errors: map[float64]float64{},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			output := &syncBuffer{}
+			code := server.NewServer(output).Serve(encode(tt.messages...))
+
+			if code != tt.code {
+				t.Errorf("Expected exit code %d, got %d", tt.code, code)
+			}
+
+			messages := decode(t, output.buf.Bytes())
+			for id, expected := range tt.errors {
+				message := response(messages, id)
+				if message == nil {
+					t.Fatalf("Expected a response to request %v", id)
+				}
+
+				responseError, _ := message["error"].(map[string]any)
+				if responseError == nil || responseError["code"] != expected {
+					t.Errorf("Expected error %v for request %v, got %v", expected, id, message)
+				}
+			}
+		})
+	}
+}
+
+func TestServeOpenDocumentsShadowDiskContent(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.php")
+	if err := os.WriteFile(path, []byte("<?php\nclass Disk {}"), 0644); err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+	uri := "file://" + path
+
+	open := `{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"` + uri + `","languageId":"php","version":1,"text":"<?php\nclass Buffer {}"}}}`
+	close := `{"jsonrpc":"2.0","method":"textDocument/didClose","params":{"textDocument":{"uri":"` + uri + `"}}}`
+	save := `{"jsonrpc":"2.0","method":"textDocument/didSave","params":{"textDocument":{"uri":"` + uri + `"},"text":"<?php\nclass Saved {}"}}`
+	symbols := `{"jsonrpc":"2.0","id":2,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"` + uri + `"}}}`
+
+	tests := map[string]struct {
+		messages []string
+		expected string
+	}{
+		"open buffer shadows the disk":    {[]string{open, symbols}, "Buffer"},
+		"closing reverts to disk content": {[]string{open, close, symbols}, "Disk"},
+		"saving refreshes disk content":   {[]string{open, save, close, symbols}, "Saved"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			output := &syncBuffer{}
+			initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootPath":"` + root + `"}}`
+			server.NewServer(output).Serve(encode(append([]string{initialize}, tt.messages...)...))
+
+			message := response(decode(t, output.buf.Bytes()), 2)
+			if message == nil {
+				t.Fatalf("Expected a response to request 2")
+			}
+
+			result := message["result"].([]any)
+			if len(result) != 1 || result[0].(map[string]any)["name"] != tt.expected {
+				t.Errorf("Expected symbol %s, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestServeAdaptsToClientCapabilities(t *testing.T) {
+	document := `<?php\nclass Foo {\n    public function bar() {}\n}`
+	open := `{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.php","languageId":"php","version":1,"text":"` + document + `"}}}`
+	symbols := `{"jsonrpc":"2.0","id":2,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"file:///a.php"}}}`
+	completion := `{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"file:///a.php","version":2},"contentChanges":[{"range":{"start":{"line":2,"character":27},"end":{"line":2,"character":27}},"text":"$this->b"}]}}`
+	complete := `{"jsonrpc":"2.0","id":3,"method":"textDocument/completion","params":{"textDocument":{"uri":"file:///a.php"},"position":{"line":2,"character":35}}}`
+
+	tests := map[string]struct {
+		capabilities string
+		symbols      string
+		completion   string
+	}{
+		"minimal client": {
+			capabilities: `{}`,
+			symbols:      `[{"kind":5,"location":{"range":{"end":{"character":1,"line":3},"start":{"character":0,"line":1}},"uri":"file:///a.php"},"name":"Foo"},{"containerName":"Foo","kind":6,"location":{"range":{"end":{"character":28,"line":2},"start":{"character":4,"line":2}},"uri":"file:///a.php"},"name":"bar"}]`,
+			completion:   `[{"documentation":{"kind":"plaintext","value":"public function bar()"},"kind":2,"label":"bar"}]`,
+		},
+		"full client": {
+			capabilities: `{"textDocument":{"documentSymbol":{"hierarchicalDocumentSymbolSupport":true,"symbolKind":{"valueSet":[5,6]}},"completion":{"completionItem":{"snippetSupport":true,"documentationFormat":["markdown","plaintext"]}}}}`,
+			symbols:      `[{"children":[{"kind":6,"name":"bar","range":{"end":{"character":28,"line":2},"start":{"character":4,"line":2}},"selectionRange":{"end":{"character":23,"line":2},"start":{"character":20,"line":2}}}],"kind":5,"name":"Foo","range":{"end":{"character":1,"line":3},"start":{"character":0,"line":1}},"selectionRange":{"end":{"character":9,"line":1},"start":{"character":6,"line":1}}}]`,
+			completion:   "[{\"documentation\":{\"kind\":\"markdown\",\"value\":\"```php\\n\\u003c?php\\npublic function bar()\\n```\"},\"insertText\":\"bar($0)\",\"insertTextFormat\":2,\"kind\":2,\"label\":\"bar\"}]",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootPath":"` + t.TempDir() + `","capabilities":` + tt.capabilities + `}}`
+
+			output := &syncBuffer{}
+			server.NewServer(output).Serve(encode(initialize, open, symbols))
+			messages := decode(t, output.buf.Bytes())
+
+			result, _ := json.Marshal(response(messages, 2)["result"])
+			if string(result) != tt.symbols {
+				t.Errorf("Expected %s, got %s", tt.symbols, result)
+			}
+
+			output = &syncBuffer{}
+			server.NewServer(output).Serve(encode(initialize, open, completion, complete))
+			messages = decode(t, output.buf.Bytes())
+
+			result, _ = json.Marshal(response(messages, 3)["result"])
+			if string(result) != tt.completion {
+				t.Errorf("Expected %s, got %s", tt.completion, result)
+			}
+		})
+	}
+}
+
+func TestServeAnswersWithErrors(t *testing.T) {
+	tests := map[string]struct {
+		message string
+		id      any
+		code    float64
+	}{
+		"unknown method": {
+			message: `{"jsonrpc":"2.0","id":"abc","method":"textDocument/unknown","params":{}}`,
+			id:      "abc",
+			code:    -32601,
+		},
+		"invalid params": {
+			message: `{"jsonrpc":"2.0","id":5,"method":"workspace/symbol","params":{"query":42}}`,
+			id:      float64(5),
+			code:    -32602,
+		},
+		"missing method": {
+			message: `{"jsonrpc":"2.0","id":6}`,
+			id:      float64(6),
+			code:    -32600,
+		},
+		"batch": {
+			message: `[{"jsonrpc":"2.0","id":7,"method":"shutdown"}]`,
+			id:      nil,
+			code:    -32600,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			input := rpc.EncodeMessage(json.RawMessage(initialize(t))) + fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(tt.message), tt.message)
+
+			output := &syncBuffer{}
+			server.NewServer(output).Serve(strings.NewReader(input))
+
+			var message map[string]any
+			for _, m := range decode(t, output.buf.Bytes()) {
+				if _, ok := m["error"]; ok {
+					message = m
+				}
+			}
+
+			if message == nil {
+				t.Fatalf("Expected an error response")
+			}
+
+			if message["id"] != tt.id {
+				t.Errorf("Expected id %v, got %v", tt.id, message["id"])
+			}
+
+			if code := message["error"].(map[string]any)["code"]; code != tt.code {
+				t.Errorf("Expected error code %v, got %v", tt.code, code)
+			}
+		})
+	}
+}
+
+func TestServeParseError(t *testing.T) {
+	broken := `{"jsonrpc":"2.0","id":1,`
+	input := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(broken), broken)
+
+	output := &syncBuffer{}
+	server.NewServer(output).Serve(strings.NewReader(input))
+
+	messages := decode(t, output.buf.Bytes())
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+
+	if messages[0]["id"] != nil || messages[0]["error"].(map[string]any)["code"] != float64(-32700) {
+		t.Errorf("Expected a parse error with a null id, got %v", messages[0])
+	}
+}
+
+func TestServeTrace(t *testing.T) {
+	tests := map[string]struct {
+		messages []string
+		traces   []string
+		verbose  bool
+	}{
+		"tracing is off by default": {
+			messages: []string{initialize(t)},
+			traces:   []string{},
+		},
+		"initialize enables tracing": {
+			messages: []string{
+				`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootPath":"` + t.TempDir() + `","trace":"messages"}}`,
+			},
+			traces: []string{"Sending response '(1)'."},
+		},
+		"setTrace switches tracing on": {
+			messages: []string{
+				initialize(t),
+				`{"jsonrpc":"2.0","method":"$/setTrace","params":{"value":"verbose"}}`,
+				`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+			},
+			traces:  []string{"Received notification 'initialized'."},
+			verbose: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			output := &syncBuffer{}
+			server.NewServer(output).Serve(encode(test.messages...))
+
+			traces := []string{}
+			for _, message := range decode(t, output.buf.Bytes()) {
+				if message["method"] != "$/logTrace" {
+					continue
+				}
+
+				params := message["params"].(map[string]any)
+				if _, ok := params["verbose"]; ok != test.verbose {
+					t.Errorf("Expected verbose %v, got %v", test.verbose, params)
+				}
+
+				if strings.Contains(params["message"].(string), "progress") {
+					continue
+				}
+				traces = append(traces, params["message"].(string))
+			}
+
+			if fmt.Sprint(traces) != fmt.Sprint(test.traces) {
+				t.Errorf("Expected %v, got %v", test.traces, traces)
+			}
+		})
+	}
+}
+
+func TestServeListenerServesSessions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer listener.Close()
+
+	go server.ServeListener(listener)
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Error connecting: %s", err)
+		}
+
+		io.Copy(conn, encode(
+			initialize(t),
+			`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+			`{"jsonrpc":"2.0","method":"exit"}`,
+		))
+
+		// the server closes the connection once the session exits
+		output, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("Error reading: %s", err)
+		}
+
+		messages := decode(t, output)
+		if response(messages, 1) == nil || response(messages, 2) == nil {
+			t.Errorf("Expected session %d to answer initialize and shutdown, got %v", i, messages)
+		}
+	}
+}
+
+// connect serves a connection and returns functions reading the next message
+// of the server and sending one to it, for tests playing the client.
+func connect(t *testing.T) (func() map[string]any, func(string), chan int) {
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+
+	code := make(chan int, 1)
+	go func() { code <- server.ServeConn(serverConn) }()
+
+	messages := bufio.NewScanner(clientConn)
+	messages.Split(rpc.Split)
+	next := func() map[string]any {
+		if !messages.Scan() {
+			t.Fatalf("Expected a message: %v", messages.Err())
+		}
+
+		_, content, _ := rpc.DecodeMessage(messages.Bytes())
+		var message map[string]any
+		json.Unmarshal(content, &message)
+		return message
+	}
+
+	// a single writer keeps messages in order without blocking the reads,
+	// net.Pipe has no buffer
+	input := make(chan string, 10)
+	t.Cleanup(func() { close(input) })
+	go func() {
+		for message := range input {
+			io.Copy(clientConn, encode(message))
+		}
+	}()
+	send := func(message string) { input <- message }
+
+	return next, send, code
+}
+
+func TestServeOnlyForwardsLogsOfItsSession(t *testing.T) {
+	next, send, code := connect(t)
+	send(initialize(t))
+	if message := next(); message["id"] != float64(1) {
+		t.Fatalf("Expected the initialize response, got %v", message)
+	}
+
+	// the other session is read until it shuts down, nothing it is sent may
+	// block the one logging
+	other := make(chan map[string]any, 100)
+	go func() {
+		defer close(other)
+		for message := next(); message["id"] != float64(2); message = next() {
+			other <- message
+		}
+	}()
+
+	input := encode(
+		initialize(t),
+		`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"file:///secret.php","version":2},"contentChanges":[{"text":"<?php"}]}}`,
+	)
+	output := &syncBuffer{}
+	server.NewServer(output).Serve(input)
+
+	forwarded := func(message map[string]any) bool {
+		return message["method"] == "window/logMessage" && strings.Contains(fmt.Sprint(message["params"]), "secret.php")
+	}
+
+	warned := false
+	for _, message := range decode(t, output.buf.Bytes()) {
+		warned = warned || forwarded(message)
+	}
+	if !warned {
+		t.Errorf("Expected the warning to be forwarded to its own client")
+	}
+
+	send(`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`)
+	for message := range other {
+		if forwarded(message) {
+			t.Errorf("Expected the warning of another session to stay there, got %v", message)
+		}
+	}
+
+	send(`{"jsonrpc":"2.0","method":"exit"}`)
+	<-code
+}
+
+func TestServeCreatesProgressTokenBeforeUsingIt(t *testing.T) {
+	tests := map[string]struct {
+		answer   func(id any) string
+		progress bool
+	}{
+		"client creates the token": {
+			answer: func(id any) string {
+				return fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":null}`, id)
+			},
+			progress: true,
+		},
+		"client refuses the token": {
+			answer: func(id any) string {
+				return fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"error":{"code":-32603,"message":"no"}}`, id)
+			},
+			progress: false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			next, send, code := connect(t)
+
+			send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootPath":"` + t.TempDir() + `","capabilities":{"window":{"workDoneProgress":true}}}}`)
+			if message := next(); message["id"] != float64(1) {
+				t.Fatalf("Expected the initialize response, got %v", message)
+			}
+
+			create := next()
+			if create["method"] != "window/workDoneProgress/create" {
+				t.Fatalf("Expected the token to be created first, got %v", create)
+			}
+			send(tt.answer(create["id"]))
+
+			progress := false
+			if tt.progress {
+				// wait for indexing to report its end
+				for !progress {
+					message := next()
+					if message["method"] == "$/progress" {
+						progress = message["params"].(map[string]any)["value"].(map[string]any)["kind"] == "end"
+					}
+				}
+			}
+
+			send(`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`)
+			for message := next(); message["id"] != float64(2); message = next() {
+				progress = progress || message["method"] == "$/progress"
+			}
+
+			if progress != tt.progress {
+				t.Errorf("Expected progress %v, got %v", tt.progress, progress)
+			}
+
+			send(`{"jsonrpc":"2.0","method":"exit"}`)
+			if c := <-code; c != 0 {
+				t.Errorf("Expected exit code 0, got %d", c)
+			}
+		})
+	}
+}
+
+func TestServeWatchesFilesChangedOutsideTheEditor(t *testing.T) {
+	root := t.TempDir()
+	next, send, code := connect(t)
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootPath":"` + root + `","capabilities":{"workspace":{"didChangeWatchedFiles":{"dynamicRegistration":true}}}}}`)
+	if message := next(); message["id"] != float64(1) {
+		t.Fatalf("Expected the initialize response, got %v", message)
+	}
+
+	register := next()
+	if register["method"] != "client/registerCapability" {
+		t.Fatalf("Expected the watchers to be registered, got %v", register)
+	}
+	registration := register["params"].(map[string]any)["registrations"].([]any)[0].(map[string]any)
+	watchers := registration["registerOptions"].(map[string]any)["watchers"].([]any)
+	if registration["method"] != "workspace/didChangeWatchedFiles" || len(watchers) != 3 {
+		t.Errorf("Expected 3 watchers of workspace/didChangeWatchedFiles, got %v", registration)
+	}
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":null}`, register["id"]))
+
+	if err := os.WriteFile(filepath.Join(root, "created.php"), []byte("<?php\nclass Created {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	send(`{"jsonrpc":"2.0","method":"workspace/didChangeWatchedFiles","params":{"changes":[{"uri":"file://` + root + `/created.php","type":1}]}}`)
+
+	// changed files are indexed in the background
+	id := 2
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"workspace/symbol","params":{"query":"Created"}}`, id))
+		message := next()
+		for message["id"] != float64(id) {
+			message = next()
+		}
+		if symbols, _ := message["result"].([]any); len(symbols) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the created class to be found, got %v", message)
+		}
+		id++
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	send(`{"jsonrpc":"2.0","id":0,"method":"shutdown"}`)
+	for message := next(); message["id"] != float64(0); message = next() {
+	}
+	send(`{"jsonrpc":"2.0","method":"exit"}`)
+	if c := <-code; c != 0 {
+		t.Errorf("Expected exit code 0, got %d", c)
+	}
+}
+
+func TestServeWorkspaceFolders(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app/App.php":             "<?php\nclass App {}",
+		"lib/Lib.php":             "<?php\nclass Lib {}",
+		"lib/generated/Skip.php":  "<?php\nclass Skip {}",
+		"added/Added.php":         "<?php\nclass Added {}",
+		"unrelated/Unrelated.php": "<?php\nclass Unrelated {}",
+	}
+	for file, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	next, send, code := connect(t)
+	folder := func(name string) string {
+		return `{"uri":"file://` + dir + `/` + name + `","name":"` + name + `"}`
+	}
+	// answer the requests of the server until the response to id
+	id := 1
+	request := func(method string, params string) map[string]any {
+		id++
+		send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"%s","params":%s}`, id, method, params))
+		for {
+			message := next()
+			if message["id"] == float64(id) && message["method"] == nil {
+				return message
+			}
+			if message["method"] == "workspace/configuration" {
+				items := message["params"].(map[string]any)["items"].([]any)
+				settings := []string{}
+				for _, item := range items {
+					scope := item.(map[string]any)["scopeUri"].(string)
+					if strings.HasSuffix(scope, "/lib") {
+						settings = append(settings, `{"indexing":{"exclude":["/generated"]}}`)
+					} else {
+						settings = append(settings, `null`)
+					}
+				}
+				send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":[%s]}`, message["id"], strings.Join(settings, ",")))
+			}
+		}
+	}
+	symbols := func(query string) int {
+		result, _ := request("workspace/symbol", `{"query":"`+query+`"}`)["result"].([]any)
+		return len(result)
+	}
+	// folders are indexed in the background, wait for them
+	eventually := func(query string, expected int) {
+		t.Helper()
+		for i := 0; symbols(query) != expected; i++ {
+			if i == 500 {
+				t.Fatalf("Expected %d symbols matching %s", expected, query)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	response := request("initialize", `{"rootPath":"`+dir+`/unrelated","workspaceFolders":[`+folder("app")+`,`+folder("lib")+`],"capabilities":{"workspace":{"configuration":true,"workspaceFolders":true}}}`)
+	capabilities := response["result"].(map[string]any)["capabilities"].(map[string]any)
+	if folders := capabilities["workspace"].(map[string]any)["workspaceFolders"].(map[string]any); folders["changeNotifications"] != true {
+		t.Errorf("Expected workspace folder changes to be supported, got %v", folders)
+	}
+
+	eventually("App", 1)
+	eventually("Lib", 1)
+	tests := map[string]int{
+		// the settings of the lib folder exclude its generated files
+		"Skip": 0,
+		// rootPath is ignored when folders are given
+		"Unrelated": 0,
+	}
+	for query, expected := range tests {
+		if got := symbols(query); got != expected {
+			t.Errorf("Expected %d symbols matching %s, got %d", expected, query, got)
+		}
+	}
+
+	send(`{"jsonrpc":"2.0","method":"workspace/didChangeWorkspaceFolders","params":{"event":{"added":[` + folder("added") + `],"removed":[` + folder("app") + `]}}}`)
+	eventually("Added", 1)
+	if got := symbols("App"); got != 0 {
+		t.Errorf("Expected the symbols of the removed folder to be dropped, got %d", got)
+	}
+
+	request("shutdown", `null`)
+	send(`{"jsonrpc":"2.0","method":"exit"}`)
+	if c := <-code; c != 0 {
+		t.Errorf("Expected exit code 0, got %d", c)
+	}
+}
+
+func TestServeCancelsAndReindexes(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.php"), []byte("<?php\nclass Indexed {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	next, send, code := connect(t)
+	until := func(id float64) map[string]any {
+		for {
+			if message := next(); message["id"] == id && message["method"] == nil {
+				return message
+			}
+		}
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootPath":"` + root + `","capabilities":{"window":{"workDoneProgress":true}}}}`)
+	response := until(1)
+	provider := response["result"].(map[string]any)["capabilities"].(map[string]any)["executeCommandProvider"]
+	if commands := provider.(map[string]any)["commands"].([]any); len(commands) != 1 || commands[0] != "php-lsp.reindex" {
+		t.Errorf("Expected the reindex command, got %v", commands)
+	}
+
+	// cancelled before the client even created the token
+	create := next()
+	token := create["params"].(map[string]any)["token"]
+	send(`{"jsonrpc":"2.0","method":"window/workDoneProgress/cancel","params":{"token":"` + token.(string) + `"}}`)
+	if message := next(); message["method"] != "$/cancelRequest" {
+		t.Fatalf("Expected the token request to be cancelled, got %v", message)
+	}
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":null}`, create["id"]))
+
+	send(`{"jsonrpc":"2.0","id":2,"method":"workspace/symbol","params":{"query":"Indexed"}}`)
+	if response := until(2); len(response["result"].([]any)) != 0 {
+		t.Errorf("Expected nothing indexed once cancelled, got %v", response["result"])
+	}
+
+	send(`{"jsonrpc":"2.0","id":3,"method":"workspace/executeCommand","params":{"command":"php-lsp.unknown"}}`)
+	if response := until(3); response["error"] == nil {
+		t.Errorf("Expected an error for an unknown command, got %v", response)
+	}
+
+	send(`{"jsonrpc":"2.0","id":4,"method":"workspace/executeCommand","params":{"command":"php-lsp.reindex"}}`)
+	until(4)
+	create = next()
+	if create["method"] != "window/workDoneProgress/create" {
+		t.Fatalf("Expected a new progress token, got %v", create)
+	}
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":null}`, create["id"]))
+
+	var values []map[string]any
+	for len(values) == 0 || values[len(values)-1]["kind"] != "end" {
+		message := next()
+		if message["method"] == "$/progress" {
+			values = append(values, message["params"].(map[string]any)["value"].(map[string]any))
+		}
+	}
+
+	expected := []map[string]any{
+		{"kind": "begin", "cancellable": true},
+		{"kind": "report", "cancellable": true, "message": "indexed 1/1 files (" + filepath.Base(root) + ")"},
+		{"kind": "end", "message": "Indexing complete"},
+	}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %d progress values, got %v", len(expected), values)
+	}
+	for i, value := range values {
+		for key, want := range expected[i] {
+			if value[key] != want {
+				t.Errorf("Expected %s %v, got %v", key, want, value)
+			}
+		}
+	}
+
+	send(`{"jsonrpc":"2.0","id":5,"method":"workspace/symbol","params":{"query":"Indexed"}}`)
+	if response := until(5); len(response["result"].([]any)) != 1 {
+		t.Errorf("Expected the reindexed class, got %v", response["result"])
+	}
+
+	send(`{"jsonrpc":"2.0","id":6,"method":"shutdown"}`)
+	until(6)
+	send(`{"jsonrpc":"2.0","method":"exit"}`)
+	if c := <-code; c != 0 {
+		t.Errorf("Expected exit code 0, got %d", c)
+	}
+}
+
+func TestServeKeepsTheCacheOfACancelledIndex(t *testing.T) {
+	root := t.TempDir()
+	dir := t.TempDir()
+	files := []string{"a.php", "b.php", "c.php"}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(root, file), []byte("<?php\nclass Cached"+file[:1]+" {}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	session := func(capabilities string) (func(float64) map[string]any, func() map[string]any, func(string), chan int) {
+		next, send, code := connect(t)
+		until := func(id float64) map[string]any {
+			for {
+				if message := next(); message["id"] == id && message["method"] == nil {
+					return message
+				}
+			}
+		}
+
+		send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootPath":"` + root + `","initializationOptions":{"cache":{"directory":"` + dir + `"}},"capabilities":` + capabilities + `}}`)
+		until(1)
+		return until, next, send, code
+	}
+	symbols := func(until func(float64) map[string]any, send func(string), id float64) int {
+		send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"method":"workspace/symbol","params":{"query":"Cached"}}`, id))
+		return len(until(id)["result"].([]any))
+	}
+	exit := func(until func(float64) map[string]any, send func(string), code chan int) {
+		send(`{"jsonrpc":"2.0","id":100,"method":"shutdown"}`)
+		until(100)
+		send(`{"jsonrpc":"2.0","method":"exit"}`)
+		<-code
+	}
+
+	// indexed until the end of its progress, once the cache is written
+	indexed := func(next func() map[string]any, send func(string), skip any) {
+		for {
+			message := next()
+			if message["method"] == "window/workDoneProgress/create" && message["id"] != skip {
+				send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":null}`, message["id"]))
+			}
+			if message["method"] == "$/progress" && message["params"].(map[string]any)["value"].(map[string]any)["kind"] == "end" {
+				return
+			}
+		}
+	}
+
+	capabilities := `{"window":{"workDoneProgress":true}}`
+	until, next, send, code := session(capabilities)
+	indexed(next, send, nil)
+	if found := symbols(until, send, 2); found != len(files) {
+		t.Fatalf("Expected the %d classes, got %d", len(files), found)
+	}
+	exit(until, send, code)
+
+	// same size and modification time, only the cache knows the old content
+	for _, file := range files {
+		path := filepath.Join(root, file)
+		info, _ := os.Stat(path)
+		os.WriteFile(path, []byte("<?php\nclass Edited"+file[:1]+" {}"), 0644)
+		os.Chtimes(path, info.ModTime(), info.ModTime())
+	}
+
+	until, next, send, code = session(capabilities)
+	create := next()
+	send(`{"jsonrpc":"2.0","method":"window/workDoneProgress/cancel","params":{"token":"` + create["params"].(map[string]any)["token"].(string) + `"}}`)
+	send(`{"jsonrpc":"2.0","id":2,"method":"workspace/executeCommand","params":{"command":"php-lsp.reindex"}}`)
+	until(2)
+	indexed(next, send, create["id"])
+
+	if found := symbols(until, send, 3); found != len(files) {
+		t.Errorf("Expected the %d cached classes, got %d", len(files), found)
+	}
+	exit(until, send, code)
+}
+
+func TestServeCanonicalizesURIs(t *testing.T) {
+	dir, _ := filepath.EvalSymlinks(t.TempDir())
+	root := filepath.Join(dir, "my project")
+	os.MkdirAll(root, 0755)
+	if err := os.WriteFile(filepath.Join(root, "User.php"), []byte("<?php\nclass Indexed {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(dir, "link")); err != nil {
+		t.Skipf("Symlinks are not supported: %s", err)
+	}
+
+	next, send, code := connect(t)
+	id := 1
+	request := func(method string, params string) map[string]any {
+		id++
+		send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"%s","params":%s}`, id, method, params))
+		for {
+			if message := next(); message["id"] == float64(id) && message["method"] == nil {
+				return message
+			}
+		}
+	}
+	symbols := func(query string) int {
+		result, _ := request("workspace/symbol", `{"query":"`+query+`"}`)["result"].([]any)
+		return len(result)
+	}
+
+	request("initialize", `{"rootUri":"file://`+filepath.ToSlash(dir)+`/my%20project","capabilities":{}}`)
+	for i := 0; symbols("Indexed") != 1; i++ {
+		if i == 500 {
+			t.Fatalf("Expected the workspace to be indexed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the same file, through a symlink and encoded differently
+	send(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file://` + filepath.ToSlash(dir) + `/link/%55ser.php","languageId":"php","version":1,"text":"<?php\nclass Opened {}"}}}`)
+
+	tests := map[string]int{
+		"Indexed": 0,
+		"Opened":  1,
+	}
+	for query, expected := range tests {
+		if got := symbols(query); got != expected {
+			t.Errorf("Expected %d symbols matching %s, got %d", expected, query, got)
+		}
+	}
+
+	response := request("textDocument/documentSymbol", `{"textDocument":{"uri":"file://`+filepath.ToSlash(root)+`/User.php"}}`)
+	if result, _ := response["result"].([]any); len(result) != 1 {
+		t.Errorf("Expected the symbols of the open document, got %v", response)
+	}
+
+	request("shutdown", `null`)
+	send(`{"jsonrpc":"2.0","method":"exit"}`)
+	if c := <-code; c != 0 {
+		t.Errorf("Expected exit code 0, got %d", c)
+	}
+}
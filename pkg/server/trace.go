@@ -0,0 +1,92 @@
+package server
+
+import (
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/rpc"
+	"fmt"
+)
+
+// setTrace changes how much of the protocol is traced to the client with
+// $/logTrace, unknown values turn tracing off.
+func (s *Server) setTrace(value string) {
+	switch value {
+	case lsp.TraceMessages, lsp.TraceVerbose:
+	default:
+		value = lsp.TraceOff
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trace = value
+}
+
+func (s *Server) traceValue() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.trace
+}
+
+// traceReceived traces a message read from the client.
+func (s *Server) traceReceived(message rpc.BaseMessage, contents []byte) {
+	if s.traceValue() == lsp.TraceOff {
+		return
+	}
+
+	switch {
+	case message.IsRequest():
+		s.logTrace(fmt.Sprintf("Received request '%s - (%s)'.", message.Method, message.ID), contents)
+	case message.IsNotification():
+		s.logTrace(fmt.Sprintf("Received notification '%s'.", message.Method), contents)
+	case message.IsResponse():
+		s.logTrace(fmt.Sprintf("Received response '(%s)'.", message.ID), contents)
+	}
+}
+
+// traceSent traces a message written to the client, except the traces
+// themselves.
+func (s *Server) traceSent(message lsp.Message, contents []byte) {
+	if s.traceValue() == lsp.TraceOff {
+		return
+	}
+
+	method, id := message.Header()
+	switch {
+	case method == "$/logTrace":
+		return
+	case method == "":
+		s.logTrace(fmt.Sprintf("Sending response '(%s)'.", id), contents)
+	case id != nil:
+		s.logTrace(fmt.Sprintf("Sending request '%s - (%s)'.", method, id), contents)
+	default:
+		s.logTrace(fmt.Sprintf("Sending notification '%s'.", method), contents)
+	}
+}
+
+func (s *Server) logTrace(message string, contents []byte) {
+	verbose := ""
+	if s.traceValue() == lsp.TraceVerbose {
+		verbose = string(contents)
+	}
+
+	s.writer.Write(lsp.NewLogTraceNotification(message, verbose))
+}
+
+// forwardLog sends warnings and errors of the server log to the client, so
+// they show up in the output of the editor without opening the log file.
+func (s *Server) forwardLog(level logger.Level, message string) {
+	messageType := lsp.MessageTypeWarning
+	if level == logger.LevelError {
+		messageType = lsp.MessageTypeError
+	}
+
+	s.writer.Write(lsp.NewLogMessageNotification(messageType, message))
+}
+
+// showMessage asks the client to show message to the user, for failures the
+// user should know about rather than find in the log.
+func (s *Server) showMessage(messageType lsp.MessageType, message string) {
+	s.writer.Write(lsp.NewShowMessageNotification(messageType, message))
+}
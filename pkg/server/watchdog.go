@@ -0,0 +1,29 @@
+package server
+
+import (
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"time"
+)
+
+// parentCheckInterval is how often the editor process is checked for.
+const parentCheckInterval = 3 * time.Second
+
+// watchParentProcess stops the server once the editor that started it dies,
+// editors that crash never send shutdown and exit.
+func (s *Server) watchParentProcess(pid int) {
+	ticker := time.NewTicker(parentCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !processAlive(pid) {
+				logger.Infof("Parent process %d is gone, exiting", pid)
+				s.stop(1)
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
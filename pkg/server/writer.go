@@ -0,0 +1,58 @@
+package server
+
+import (
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/rpc"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// writer serializes messages to the client, responses are written from
+// several goroutines and must never interleave.
+type writer struct {
+	mu sync.Mutex
+	w  io.Writer
+	// broken is set once a write failed, the connection is gone and further
+	// messages are dropped. Logging every one of them would only forward
+	// more messages to the same dead connection.
+	broken bool
+	// log is the logger of the session.
+	log *logger.Logger
+
+	// sent is called with every message written and its content, outside of
+	// the lock so it may write messages itself.
+	sent func(message lsp.Message, content []byte)
+}
+
+// Write sends message to the client. A message that cannot be encoded is
+// logged and dropped, it may come from a goroutine no handler recovers.
+func (w *writer) Write(message lsp.Message) {
+	content, err := json.Marshal(message)
+	if err != nil {
+		w.log.Errorf("Error encoding message: %s", err)
+		return
+	}
+	reply := rpc.EncodeContent(content)
+
+	w.mu.Lock()
+	if w.broken {
+		w.mu.Unlock()
+		return
+	}
+
+	if _, err := w.w.Write([]byte(reply)); err != nil {
+		w.broken = true
+		w.mu.Unlock()
+		w.log.Errorf("Error writing response: %s", err)
+		return
+	}
+	w.mu.Unlock()
+
+	logger.Debugf("Sending response: [%s]", reply)
+
+	if w.sent != nil {
+		w.sent(message, content)
+	}
+}
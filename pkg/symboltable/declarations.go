@@ -0,0 +1,47 @@
+package symboltable
+
+import (
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+)
+
+// FromDeclarations builds the symbols of uri from its declarations as
+// extracted by treesitter.GetDeclarationSymbols. rangeOf converts the
+// positions of the content to those of the client.
+func FromDeclarations(uri string, declarations []treesitter.Symbol, rangeOf func(treesitter.Position) lsp.Range) []Symbol {
+	symbols := []Symbol{}
+	appendDeclarations(&symbols, uri, declarations, rangeOf)
+
+	return symbols
+}
+
+func appendDeclarations(symbols *[]Symbol, uri string, declarations []treesitter.Symbol, rangeOf func(treesitter.Position) lsp.Range) {
+	for _, declaration := range declarations {
+		switch declaration.Kind {
+		case treesitter.Kind_Namespace:
+			appendDeclarations(symbols, uri, declaration.Children, rangeOf)
+
+		case treesitter.Kind_Class, treesitter.Kind_Interface, treesitter.Kind_Enum, treesitter.Kind_Struct,
+			treesitter.Kind_Function, treesitter.Kind_Constant:
+			symbol := Symbol{
+				FQN:            declaration.FQN,
+				Name:           declaration.Name,
+				Kind:           declaration.Kind,
+				URI:            uri,
+				Range:          rangeOf(declaration.Range),
+				SelectionRange: rangeOf(declaration.Position),
+			}
+
+			for _, member := range declaration.Children {
+				symbol.Members = append(symbol.Members, Member{
+					Name:           member.Name,
+					Kind:           member.Kind,
+					Range:          rangeOf(member.Range),
+					SelectionRange: rangeOf(member.Position),
+				})
+			}
+
+			*symbols = append(*symbols, symbol)
+		}
+	}
+}
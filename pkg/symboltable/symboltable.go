@@ -0,0 +1,302 @@
+package symboltable
+
+import (
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Symbol is a declaration other files can refer to: a class, interface,
+// trait, enum, function or constant.
+type Symbol struct {
+	// FQN is the fully qualified name, without the leading backslash.
+	FQN  string
+	Name string
+	Kind uint32
+	URI  string
+	// Range is the range of the declaration, SelectionRange that of its
+	// name, in the positions of the client.
+	Range          lsp.Range
+	SelectionRange lsp.Range
+	// Members are the methods, properties and constants of classes.
+	Members []Member
+}
+
+type Member struct {
+	Name           string
+	Kind           uint32
+	Range          lsp.Range
+	SelectionRange lsp.Range
+}
+
+// Namespace returns the namespace of the symbol, empty for the global one.
+func (s Symbol) Namespace() string {
+	if i := strings.LastIndex(s.FQN, "\\"); i >= 0 {
+		return s.FQN[:i]
+	}
+
+	return ""
+}
+
+// Table is the index of the symbols of the workspace by fully qualified name,
+// with the symbols of each file so a changed file replaces its own.
+//
+// Like the documents of the workspace, a file has the symbols of its content
+// on disk and, while it is open in the editor, those of its buffer which
+// shadow them.
+type Table struct {
+	// mu guards every field. The sorted names are rebuilt on the first
+	// search after a change, indexing changes many files in a row.
+	mu     sync.RWMutex
+	disk   map[string][]Symbol
+	open   map[string][]Symbol
+	byName map[string][]Symbol
+	sorted []entry
+	dirty  bool
+}
+
+// entry is a name searched by prefix, the fully qualified name or the short
+// one, in lower case.
+type entry struct {
+	name string
+	key  string
+}
+
+func New() *Table {
+	return &Table{
+		disk:   make(map[string][]Symbol),
+		open:   make(map[string][]Symbol),
+		byName: make(map[string][]Symbol),
+	}
+}
+
+// key is how a name is looked up. PHP names are case insensitive, except
+// for constants which are filtered again on lookup.
+func key(fqn string) string {
+	return strings.ToLower(strings.TrimPrefix(fqn, "\\"))
+}
+
+// Update replaces the symbols of the content on disk of uri.
+func (t *Table) Update(uri string, symbols []Symbol) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.unindex(uri)
+	t.disk[uri] = symbols
+	t.index(uri)
+}
+
+// Remove drops the symbols of the content on disk of uri, the file was
+// deleted.
+func (t *Table) Remove(uri string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.unindex(uri)
+	delete(t.disk, uri)
+	t.index(uri)
+}
+
+// Open replaces the symbols of the buffer of uri open in the editor.
+func (t *Table) Open(uri string, symbols []Symbol) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.unindex(uri)
+	t.open[uri] = symbols
+	t.index(uri)
+}
+
+// Close drops the symbols of the buffer of uri, those on disk apply again.
+func (t *Table) Close(uri string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.unindex(uri)
+	delete(t.open, uri)
+	t.index(uri)
+}
+
+// effective returns the symbols of uri that apply, t.mu must be held.
+func (t *Table) effective(uri string) []Symbol {
+	if symbols, ok := t.open[uri]; ok {
+		return symbols
+	}
+
+	return t.disk[uri]
+}
+
+func (t *Table) index(uri string) {
+	for _, symbol := range t.effective(uri) {
+		k := key(symbol.FQN)
+		t.byName[k] = append(t.byName[k], symbol)
+	}
+	t.dirty = true
+}
+
+func (t *Table) unindex(uri string) {
+	for _, symbol := range t.effective(uri) {
+		k := key(symbol.FQN)
+		symbols := t.byName[k]
+
+		kept := symbols[:0:0]
+		for _, s := range symbols {
+			if s.URI != uri {
+				kept = append(kept, s)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(t.byName, k)
+		} else {
+			t.byName[k] = kept
+		}
+	}
+	t.dirty = true
+}
+
+// File returns the symbols declared by uri.
+func (t *Table) File(uri string) []Symbol {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.effective(uri)
+}
+
+// Lookup returns the symbols declared with a fully qualified name, several
+// files may declare the same one.
+func (t *Table) Lookup(fqn string) []Symbol {
+	fqn = strings.TrimPrefix(fqn, "\\")
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var found []Symbol
+	for _, symbol := range t.byName[key(fqn)] {
+		if symbol.Kind == treesitter.Kind_Constant && symbol.FQN != fqn {
+			continue
+		}
+		found = append(found, symbol)
+	}
+
+	return found
+}
+
+// Resolve returns the symbols a name written at a position with imports
+// refers to. kind is Kind_Function or Kind_Constant for calls and constants,
+// any other kind resolves a class name. Unqualified functions and constants
+// fall back to the global namespace when the current one does not declare
+// them, as PHP does.
+func (t *Table) Resolve(name string, kind uint32, imports treesitter.Imports) []Symbol {
+	var aliases map[string]string
+	alias := strings.ToLower(name)
+	switch kind {
+	case treesitter.Kind_Function:
+		aliases = imports.Functions
+	case treesitter.Kind_Constant:
+		aliases = imports.Constants
+		alias = name
+	default:
+		return t.Lookup(imports.Qualify(name))
+	}
+
+	if strings.Contains(name, "\\") {
+		return t.lookupKind(imports.Qualify(name), kind)
+	}
+
+	if imported, ok := aliases[alias]; ok {
+		return t.lookupKind(imported, kind)
+	}
+
+	if imports.Namespace != "" {
+		if found := t.lookupKind(imports.Namespace+"\\"+name, kind); len(found) > 0 {
+			return found
+		}
+	}
+
+	return t.lookupKind(name, kind)
+}
+
+func (t *Table) lookupKind(fqn string, kind uint32) []Symbol {
+	var found []Symbol
+	for _, symbol := range t.Lookup(fqn) {
+		if symbol.Kind == kind {
+			found = append(found, symbol)
+		}
+	}
+
+	return found
+}
+
+// Search returns the symbols whose fully qualified name or short name starts
+// with prefix, case insensitively. At most limit symbols are returned, all of
+// them when limit is zero.
+func (t *Table) Search(prefix string, limit int) []Symbol {
+	prefix = strings.ToLower(strings.TrimPrefix(prefix, "\\"))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.dirty {
+		t.sort()
+	}
+
+	var found []Symbol
+	seen := make(map[string]bool)
+	start := sort.Search(len(t.sorted), func(i int) bool { return t.sorted[i].name >= prefix })
+	for _, e := range t.sorted[start:] {
+		if !strings.HasPrefix(e.name, prefix) {
+			break
+		}
+
+		if seen[e.key] {
+			continue
+		}
+		seen[e.key] = true
+
+		for _, symbol := range t.byName[e.key] {
+			found = append(found, symbol)
+			if limit > 0 && len(found) == limit {
+				return found
+			}
+		}
+	}
+
+	return found
+}
+
+// sort rebuilds the sorted names, t.mu must be held for writing.
+func (t *Table) sort() {
+	sorted := make([]entry, 0, 2*len(t.byName))
+	for k := range t.byName {
+		sorted = append(sorted, entry{name: k, key: k})
+		if i := strings.LastIndex(k, "\\"); i >= 0 {
+			sorted = append(sorted, entry{name: k[i+1:], key: k})
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].name != sorted[j].name {
+			return sorted[i].name < sorted[j].name
+		}
+		return sorted[i].key < sorted[j].key
+	})
+
+	t.sorted = sorted
+	t.dirty = false
+}
+
+// All returns every symbol of the table.
+func (t *Table) All() []Symbol {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var all []Symbol
+	for _, symbols := range t.byName {
+		all = append(all, symbols...)
+	}
+
+	return all
+}
@@ -0,0 +1,167 @@
+package symboltable_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/symboltable"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func symbols(uri string, code string) []symboltable.Symbol {
+	_, declarations := treesitter.Extract(code, treesitter.ModeDeclarations)
+
+	return symboltable.FromDeclarations(uri, declarations, func(p treesitter.Position) lsp.Range {
+		return lsp.Range{Start: lsp.Position{Line: int(p.LineStart)}, End: lsp.Position{Line: int(p.LineEnd)}}
+	})
+}
+
+// names returns the sorted uri:FQN of symbols.
+func names(symbols []symboltable.Symbol) []string {
+	result := []string{}
+	for _, symbol := range symbols {
+		result = append(result, symbol.URI+":"+symbol.FQN)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+func newTable() *symboltable.Table {
+	table := symboltable.New()
+	table.Update("admin.php", symbols("admin.php", `<?php
+namespace App\Admin;
+class User {}
+function helper() {}
+const LIMIT = 1;`))
+	table.Update("models.php", symbols("models.php", `<?php
+namespace App\Models;
+class User {
+	public $name;
+	public function save() {}
+}
+interface HasName {}
+enum Status { case Active; }`))
+	table.Update("global.php", symbols("global.php", `<?php
+function helper() {}
+function strlen_utf8() {}
+define('APP_VERSION', '1.0');`))
+
+	return table
+}
+
+func TestLookup(t *testing.T) {
+	table := newTable()
+
+	tests := map[string][]string{
+		`App\Models\User`:  {`models.php:App\Models\User`},
+		`\App\Admin\User`:  {`admin.php:App\Admin\User`},
+		`app\models\user`:  {`models.php:App\Models\User`},
+		`App\Admin\LIMIT`:  {`admin.php:App\Admin\LIMIT`},
+		`App\Admin\limit`:  {},
+		`helper`:           {`global.php:helper`},
+		`App\Models\Other`: {},
+	}
+
+	for fqn, expected := range tests {
+		t.Run(fqn, func(t *testing.T) {
+			if got := names(table.Lookup(fqn)); !reflect.DeepEqual(got, expected) {
+				t.Errorf("Expected %v, got %v", expected, got)
+			}
+		})
+	}
+
+	user := table.Lookup(`App\Models\User`)[0]
+	if user.Name != "User" || user.Namespace() != `App\Models` || len(user.Members) != 2 {
+		t.Errorf("Expected User in App\\Models with 2 members, got %v", user)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	table := newTable()
+
+	tests := map[string]struct {
+		prefix   string
+		limit    int
+		expected []string
+	}{
+		"short name":    {prefix: "us", expected: []string{`admin.php:App\Admin\User`, `models.php:App\Models\User`}},
+		"namespace":     {prefix: `App\Models\`, expected: []string{`models.php:App\Models\HasName`, `models.php:App\Models\Status`, `models.php:App\Models\User`}},
+		"leading slash": {prefix: `\app\admin\h`, expected: []string{`admin.php:App\Admin\helper`}},
+		"limit":         {prefix: "h", limit: 1, expected: []string{`models.php:App\Models\HasName`}},
+		"nothing":       {prefix: "zzz", expected: []string{}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := names(table.Search(tt.prefix, tt.limit)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdatesReplaceTheSymbolsOfAFile(t *testing.T) {
+	table := newTable()
+
+	table.Update("admin.php", symbols("admin.php", `<?php
+namespace App\Admin;
+class Admin {}`))
+	if got := names(table.Search("user", 0)); !reflect.DeepEqual(got, []string{`models.php:App\Models\User`}) {
+		t.Errorf("Expected the old symbols of the file to be gone, got %v", got)
+	}
+
+	table.Open("models.php", symbols("models.php", `<?php
+namespace App\Models;
+class Person {}`))
+	if got := names(table.Lookup(`App\Models\User`)); len(got) != 0 {
+		t.Errorf("Expected the open buffer to shadow the disk content, got %v", got)
+	}
+
+	table.Close("models.php")
+	if got := names(table.Lookup(`App\Models\User`)); len(got) != 1 {
+		t.Errorf("Expected the disk content back once closed, got %v", got)
+	}
+
+	table.Remove("models.php")
+	if got := names(table.File("models.php")); len(got) != 0 {
+		t.Errorf("Expected no symbols for a removed file, got %v", got)
+	}
+	if got := names(table.Search(`App\Models`, 0)); len(got) != 0 {
+		t.Errorf("Expected removed symbols not to be found, got %v", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	table := newTable()
+	imports := treesitter.Imports{
+		Namespace: `App\Admin`,
+		Classes:   map[string]string{"person": `App\Models\User`, "models": `App\Models`},
+		Functions: map[string]string{},
+		Constants: map[string]string{"VERSION": "APP_VERSION"},
+	}
+
+	tests := map[string]struct {
+		name     string
+		kind     uint32
+		expected []string
+	}{
+		"class of the namespace":          {name: "User", kind: treesitter.Kind_Class, expected: []string{`admin.php:App\Admin\User`}},
+		"aliased class":                   {name: "Person", kind: treesitter.Kind_Class, expected: []string{`models.php:App\Models\User`}},
+		"qualified through an import":     {name: `Models\Status`, kind: treesitter.Kind_Class, expected: []string{`models.php:App\Models\Status`}},
+		"function of the namespace":       {name: "helper", kind: treesitter.Kind_Function, expected: []string{`admin.php:App\Admin\helper`}},
+		"global function fallback":        {name: "strlen_utf8", kind: treesitter.Kind_Function, expected: []string{`global.php:strlen_utf8`}},
+		"fully qualified global function": {name: `\helper`, kind: treesitter.Kind_Function, expected: []string{`global.php:helper`}},
+		"imported constant":               {name: "VERSION", kind: treesitter.Kind_Constant, expected: []string{`global.php:APP_VERSION`}},
+		"constant of the namespace":       {name: "LIMIT", kind: treesitter.Kind_Constant, expected: []string{`admin.php:App\Admin\LIMIT`}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := names(table.Resolve(tt.name, tt.kind, imports)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package treesitter
+
+import (
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Mode selects which symbols are extracted from a document.
+type Mode int
+
+const (
+	// ModeFull extracts every symbol, local variables included, for the
+	// sources of the project.
+	ModeFull Mode = iota
+	// ModeDeclarations only extracts what other files can refer to:
+	// namespaces, classes, interfaces, traits, enums, functions, constants
+	// and class members. Function bodies are skipped, for vendor and
+	// library files.
+	ModeDeclarations
+)
+
+func (m Mode) String() string {
+	if m == ModeDeclarations {
+		return "declarations"
+	}
+
+	return "full"
+}
+
+// Extract parses content once and returns its symbols in the given mode
+// along with its declarations, which are the same in ModeDeclarations.
+func Extract(content string, mode Mode) (symbols []Symbol, declarations []Symbol) {
+	tree, err := ParseDocument(content)
+	if err != nil {
+		return []Symbol{}, []Symbol{}
+	}
+
+	declarations = GetDeclarationSymbols(content, tree)
+	if mode == ModeDeclarations {
+		return declarations, declarations
+	}
+
+	return GetTreeSymbols(content, tree), declarations
+}
+
+// GetDeclarationSymbols returns the declarations of an already parsed
+// document, the symbols of ModeDeclarations.
+func GetDeclarationSymbols(content string, tree *sitter.Tree) []Symbol {
+	symbols := []Symbol{}
+	w := &walker{content: content, declarations: true}
+	w.walk(tree.RootNode(), &symbols)
+
+	return symbols
+}
+
+// Declarations returns the declarations among symbols extracted in
+// ModeFull, the symbols ModeDeclarations extracts from the same content.
+// Open documents take them from their outline rather than walking their
+// whole tree again.
+func Declarations(symbols []Symbol) []Symbol {
+	var declarations []Symbol
+	for _, symbol := range symbols {
+		switch {
+		case symbol.Kind == Kind_Namespace:
+			symbol.Children = Declarations(symbol.Children)
+		case symbol.FQN == "":
+			// variables, references and members outside of a declaration
+			continue
+		case symbol.Kind == Kind_Function || symbol.Kind == Kind_Constant:
+			symbol.Children = nil
+		default:
+			symbol.Children = members(symbol.Children)
+		}
+		declarations = append(declarations, symbol)
+	}
+
+	return declarations
+}
+
+// members returns the members among the children of a class like
+// declaration, without the symbols of method bodies.
+func members(symbols []Symbol) []Symbol {
+	var members []Symbol
+	for _, symbol := range symbols {
+		switch symbol.Kind {
+		case Kind_Method, Kind_Property, Kind_Constant, Kind_EnumMember:
+			symbol.Children = nil
+			members = append(members, symbol)
+		}
+	}
+
+	return members
+}
+
+var declarationKinds = map[string]uint32{
+	"class_declaration":     Kind_Class,
+	"interface_declaration": Kind_Interface,
+	"trait_declaration":     Kind_Struct,
+	"enum_declaration":      Kind_Enum,
+}
+
+// defineName returns the name of the constant declared by a
+// define('NAME', ...) call, nil for other calls or names that are not a
+// literal string.
+func defineName(content string, call *sitter.Node) *sitter.Node {
+	function := call.ChildByFieldName("function")
+	if function == nil || GetNodeText(content, function) != "define" {
+		return nil
+	}
+
+	arguments := call.ChildByFieldName("arguments")
+	if arguments == nil || arguments.NamedChildCount() == 0 {
+		return nil
+	}
+
+	argument := arguments.NamedChild(0)
+	if argument.NamedChildCount() != 1 {
+		return nil
+	}
+
+	str := argument.NamedChild(0)
+	if str.Type() != "string" || str.NamedChildCount() != 1 || str.NamedChild(0).Type() != "string_content" {
+		return nil
+	}
+
+	return str.NamedChild(0)
+}
@@ -0,0 +1,142 @@
+package treesitter_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// outline flattens symbols to kind:name strings, children in parentheses.
+func outline(symbols []treesitter.Symbol) string {
+	result := ""
+	for i, symbol := range symbols {
+		if i > 0 {
+			result += " "
+		}
+
+		result += fmt.Sprintf("%s:%s", treesitter.Kind_Labels[int(symbol.Kind)], symbol.Name)
+		if len(symbol.Children) > 0 {
+			result += "(" + outline(symbol.Children) + ")"
+		}
+	}
+
+	return result
+}
+
+func TestExtractDeclarations(t *testing.T) {
+	tests := map[string]struct {
+		code     string
+		expected string
+	}{
+		"skips variables and bodies": {
+			code: `<?php
+			$foo = 'bar';
+			function foo($a) {
+				$b = 1;
+				function inner() {}
+			}`,
+			expected: "Function:foo",
+		},
+		"class members": {
+			code: `<?php
+			class User extends Model implements Foo {
+				use HasName;
+				const X = 1, Y = 2;
+				public $a, $b;
+				public function __construct(private readonly int $id, $other) { $z = 2; }
+			}`,
+			expected: "Class:User(Constant:X Constant:Y Property:a Property:b Method:__construct Property:id)",
+		},
+		"interfaces traits and enums": {
+			code: `<?php
+			interface I { public function m(); }
+			trait T { protected $p; }
+			enum Suit: string { case Hearts = 'H'; case Spades = 'S'; }`,
+			expected: "Interface:I(Method:m) Struct:T(Property:p) Enum:Suit(EnumMember:Hearts EnumMember:Spades)",
+		},
+		"enums with constants": {
+			code: `<?php
+			enum Suit: string {
+				case Hearts = 'H';
+				public const Wild = self::Hearts;
+				public function label() { $x = 1; }
+			}
+			function after() {}`,
+			expected: "Enum:Suit(EnumMember:Hearts Constant:Wild Method:label) Function:after",
+		},
+		"constants": {
+			code: `<?php
+			const A = 1;
+			define('FOO', 1);
+			define($name, 1);`,
+			expected: "Constant:A Constant:FOO",
+		},
+		"namespaces without braces": {
+			code: `<?php
+			namespace App\Models;
+			class User {}
+			function helper() {}
+			namespace Other;
+			class B {}`,
+			expected: "Namespace:App\\Models(Class:User Function:helper) Namespace:Other(Class:B)",
+		},
+		"namespaces with braces": {
+			code: `<?php
+			namespace App { class A {} }
+			namespace { class Root {} }`,
+			expected: "Namespace:App(Class:A) Class:Root",
+		},
+		"declarations in conditions": {
+			code: `<?php
+			if (!function_exists('helper')) {
+				function helper() {}
+			}`,
+			expected: "Function:helper",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, declarations := treesitter.Extract(tt.code, treesitter.ModeDeclarations)
+			if got := outline(declarations); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+
+			// the same declarations are found among the symbols of ModeFull
+			symbols, _ := treesitter.Extract(tt.code, treesitter.ModeFull)
+			found := treesitter.Declarations(symbols)
+			if len(found) != 0 || len(declarations) != 0 {
+				if !reflect.DeepEqual(found, declarations) {
+					t.Errorf("Expected %v, got %v", declarations, found)
+				}
+			}
+		})
+	}
+}
+
+func TestDeclarationsAreQualified(t *testing.T) {
+	code := `<?php
+	namespace App\Models;
+	class User {}
+	function helper() {}
+	const VERSION = 1;
+	define('GLOBAL_FOO', 1);`
+
+	for _, mode := range []treesitter.Mode{treesitter.ModeFull, treesitter.ModeDeclarations} {
+		symbols, _ := treesitter.Extract(code, mode)
+		if len(symbols) != 1 {
+			t.Fatalf("Expected the namespace, got %v", outline(symbols))
+		}
+
+		var got []string
+		for _, symbol := range symbols[0].Children {
+			got = append(got, symbol.FQN)
+		}
+
+		expected := []string{"App\\Models\\User", "App\\Models\\helper", "App\\Models\\VERSION", "GLOBAL_FOO"}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected %v in %s mode, got %v", expected, mode, got)
+		}
+	}
+}
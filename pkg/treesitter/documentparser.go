@@ -3,6 +3,7 @@ package treesitter
 import (
 	"ahmedash95/php-lsp-server/pkg/lsp"
 	"context"
+	"sync"
 
 	sitter "github.com/smacker/go-tree-sitter"
 	"github.com/smacker/go-tree-sitter/php"
@@ -46,6 +47,7 @@ const (
 	Kind_Class_Label         = "Class"
 	Kind_Interface_Label     = "Interface"
 	Kind_Module_Label        = "Module"
+	Kind_Namespace_Label     = "Namespace"
 	Kind_Property_Label      = "Property"
 	Kind_Unit_Label          = "Unit"
 	Kind_Value_Label         = "Value"
@@ -73,6 +75,7 @@ var Kind_Labels = map[int]string{
 	Kind_Class:         Kind_Class_Label,
 	Kind_Interface:     Kind_Interface_Label,
 	Kind_Module:        Kind_Module_Label,
+	Kind_Namespace:     Kind_Namespace_Label,
 	Kind_Property:      Kind_Property_Label,
 	Kind_Enum:          Kind_Enum_Label,
 	Kind_File:          Kind_File_Label,
@@ -90,13 +93,44 @@ type TextDocumentItem struct {
 	Version         int                  `json:"version"`
 	Text            string               `json:"text"`
 	DocumentSymbols []lsp.DocumentSymbol `json:"documentSymbols"`
+
+	// Tree is the syntax tree of Text, kept for open documents so changes
+	// can be reparsed incrementally. Trees are not thread safe, readers
+	// must work on a copy.
+	Tree *sitter.Tree `json:"-"`
+
+	// Lines maps between byte offsets in Text and client positions.
+	Lines *LineIndex `json:"-"`
+
+	// Outline holds the symbols of an open document by statement and class
+	// member, so a change only extracts those it touched again.
+	Outline *Outline `json:"-"`
+	// Changed are the ranges of Tree whose syntax may differ from the
+	// previous version of an open document.
+	Changed []sitter.Range `json:"-"`
+}
+
+// parsers are reused across parses, a parser only parses one document at a
+// time.
+var parsers = sync.Pool{
+	New: func() any {
+		parser := sitter.NewParser()
+		parser.SetLanguage(php.GetLanguage())
+		return parser
+	},
 }
 
 func ParseDocument(content string) (*sitter.Tree, error) {
-	parser := sitter.NewParser()
-	parser.SetLanguage(php.GetLanguage())
+	return ParseDocumentIncremental(nil, content)
+}
+
+// ParseDocumentIncremental parses content reusing the unchanged parts of
+// oldTree, which must already have been edited to match content.
+func ParseDocumentIncremental(oldTree *sitter.Tree, content string) (*sitter.Tree, error) {
+	parser := parsers.Get().(*sitter.Parser)
+	defer parsers.Put(parser)
 
-	return parser.ParseCtx(context.Background(), nil, []byte(content))
+	return parser.ParseCtx(context.Background(), oldTree, []byte(content))
 }
 
 func GetNodeText(content string, node *sitter.Node) string {
@@ -1,9 +1,15 @@
 package treesitter
 
 import (
+	"strings"
+
 	sitter "github.com/smacker/go-tree-sitter"
 )
 
+// ExtractorVersion must change whenever WalkTree extracts different symbols
+// from the same content, symbols cached by an older version are discarded.
+const ExtractorVersion = 7
+
 type Position struct {
 	LineStart   uint32
 	LineEnd     uint32
@@ -12,9 +18,15 @@ type Position struct {
 }
 
 type Symbol struct {
-	Name     string
-	Kind     uint32
+	Name string
+	// FQN is the fully qualified name of a declared class, interface,
+	// trait, function or constant, empty for other symbols.
+	FQN  string
+	Kind uint32
+	// Position is the range of the name, Range that of the whole
+	// declaration with its attributes and doc comment.
 	Position Position
+	Range    Position
 	Children []Symbol
 }
 
@@ -24,6 +36,11 @@ func GetDocumentSymbols(content string) []Symbol {
 		return []Symbol{}
 	}
 
+	return GetTreeSymbols(content, tree)
+}
+
+// GetTreeSymbols returns the symbols of an already parsed document.
+func GetTreeSymbols(content string, tree *sitter.Tree) []Symbol {
 	var symbols []Symbol
 
 	WalkTree(content, tree.RootNode(), &symbols)
@@ -31,18 +48,143 @@ func GetDocumentSymbols(content string) []Symbol {
 }
 
 func WalkTree(content string, node *sitter.Node, symbols *[]Symbol) {
+	w := &walker{content: content}
+	w.walk(node, symbols)
+}
+
+// walker extracts the symbols of a tree. Statements and class members are
+// units, an outline reuses the symbols of those an edit did not touch.
+type walker struct {
+	content string
+	// declarations only extracts the declarations, as in ModeDeclarations.
+	declarations bool
+	// namespace is the namespace of the statements being walked.
+	namespace string
+	// reuse returns the symbols of an unchanged unit spanning extent, after
+	// adding the units nested in it.
+	reuse func(node *sitter.Node, extent sitter.Range) ([]Symbol, bool)
+	// units are the units walked, changed those of them walked again whose
+	// units were all reused.
+	units   []unit
+	changed []sitter.Range
+	// recovered is the range of the last enum recovered, the nodes it
+	// spans are its members. reparsed is set when walking an enum parsed
+	// again, which is not recovered twice.
+	recovered sitter.Range
+	reparsed  bool
+}
+
+// unit walks node, a unit, unless its symbols can be reused.
+func (w *walker) unit(node *sitter.Node, symbols *[]Symbol) {
+	// the members of a recovered enum are walked with it
+	if node.StartByte() < w.recovered.EndByte {
+		w.walk(node, symbols)
+		return
+	}
+
+	// a recovered enum spans the nodes of its members, it is only reused
+	// as a unit spanning them when it was recovered
+	extent := w.extent(node)
+	lookup := extent
+	if !w.reparsed && recovers(node) {
+		if broken, ok := w.scanEnum(node); ok && broken.span.EndByte > extent.EndByte {
+			lookup.EndByte = broken.span.EndByte
+			lookup.EndPoint = broken.span.EndPoint
+		}
+	}
+
+	before := len(w.units)
+	var unitSymbols []Symbol
+	reused := false
+	if w.reuse != nil {
+		unitSymbols, reused = w.reuse(node, lookup)
+	}
+
+	if reused {
+		if lookup.EndByte > extent.EndByte {
+			w.recovered = lookup
+		}
+		extent = lookup
+	} else {
+		changed := len(w.changed)
+		recovered := w.recovered
+		w.walk(node, &unitSymbols)
+		if w.recovered != recovered && w.recovered.EndByte > extent.EndByte {
+			extent.EndByte = w.recovered.EndByte
+			extent.EndPoint = w.recovered.EndPoint
+		}
+		if len(w.changed) == changed {
+			w.changed = append(w.changed, extent)
+		}
+	}
+
+	w.units = append(w.units, unit{
+		kind:      node.Type(),
+		parent:    parentType(node),
+		start:     extent.StartPoint,
+		startByte: extent.StartByte,
+		endByte:   extent.EndByte,
+		symbols:   unitSymbols,
+		namespace: w.namespace,
+		nested:    len(w.units) - before,
+	})
+	*symbols = append(*symbols, unitSymbols...)
+}
+
+func (w *walker) walk(node *sitter.Node, symbols *[]Symbol) {
+	content := w.content
+	count := len(*symbols)
+
+	if node.StartByte() < w.recovered.EndByte {
+		// only the part past the recovered enum is walked
+		if node.EndByte() > w.recovered.EndByte {
+			for child := node.Child(0); child != nil; child = child.NextSibling() {
+				w.walk(child, symbols)
+			}
+		}
+		return
+	}
+
+	if !w.reparsed && recovers(node) {
+		if symbol, span, ok := w.recoverEnum(node); ok {
+			// statements an ERROR holds before the enum keep their symbols
+			if node.Type() == "ERROR" {
+				for child := node.Child(0); child.Type() != "enum"; child = child.NextSibling() {
+					w.walk(child, symbols)
+				}
+			}
+
+			*symbols = append(*symbols, symbol)
+			w.recovered = span
+			return
+		}
+	}
 
 	switch node.Type() {
 	case "variable_name":
+		if w.declarations {
+			return
+		}
 		n := node.Child(1)
 		*symbols = append(*symbols, getSymbolFromNode(content, Kind_Variable, n))
+	case "namespace_definition":
+		w.walkNamespace(node, symbols)
+		return
 	case "function_definition":
-		n := node.Child(1)
-		*symbols = append(*symbols, getSymbolFromNode(content, Kind_Function, n))
-	case "class_declaration":
-		n := findNodeOfType(node, "name")
-		*symbols = append(*symbols, getSymbolFromNode(content, Kind_Class, n))
+		if n := node.ChildByFieldName("name"); n != nil {
+			*symbols = append(*symbols, w.declaration(Kind_Function, node, n))
+		}
+		if w.declarations {
+			return
+		}
+	case "class_declaration", "interface_declaration", "trait_declaration", "enum_declaration":
+		if n := node.ChildByFieldName("name"); n != nil {
+			*symbols = append(*symbols, w.declaration(declarationKinds[node.Type()], node, n))
+		}
 	case "base_clause":
+		if w.declarations {
+			return
+		}
 		var kind uint32
 		if node.Parent().Type() == "interface_declaration" {
 			kind = Kind_Interface
@@ -53,53 +195,140 @@ func WalkTree(content string, node *sitter.Node, symbols *[]Symbol) {
 			*symbols = append(*symbols, getSymbolFromNode(content, kind, node.NamedChild(i)))
 		}
 	case "class_interface_clause":
+		if w.declarations {
+			return
+		}
 		for i := 0; i < int(node.NamedChildCount()); i++ {
 			n := node.NamedChild(i)
 			*symbols = append(*symbols, getSymbolFromNode(content, Kind_Interface, n))
 		}
-	case "interface_declaration":
-		n := node.Child(1)
-		*symbols = append(*symbols, getSymbolFromNode(content, Kind_Interface, n))
-	case "trait_declaration":
-		n := node.Child(1)
-		*symbols = append(*symbols, getSymbolFromNode(content, Kind_Class, n))
 	case "use_declaration":
+		// traits used by a class, the conflict resolution block is skipped
+		if w.declarations {
+			return
+		}
 		for i := 0; i < int(node.NamedChildCount()); i++ {
 			n := node.NamedChild(i)
-			*symbols = append(*symbols, getSymbolFromNode(content, Kind_Class, n))
+			if n.Type() == "name" || n.Type() == "qualified_name" {
+				*symbols = append(*symbols, getSymbolFromNode(content, Kind_Struct, n))
+			}
 		}
+		return
 	case "method_declaration":
-		n := findNodeOfType(node, "name")
-		*symbols = append(*symbols, getSymbolFromNode(content, Kind_Method, n))
+		n := node.ChildByFieldName("name")
+		if n == nil {
+			break
+		}
+
+		method := w.member(Kind_Method, node, n)
+		for child := node.Child(0); child != nil && !w.declarations; child = child.NextSibling() {
+			w.walk(child, &method.Children)
+		}
+		*symbols = append(*symbols, method)
+
+		// promoted constructor parameters are properties of the class
+		if parameters := node.ChildByFieldName("parameters"); parameters != nil {
+			for i := 0; i < int(parameters.NamedChildCount()); i++ {
+				parameter := parameters.NamedChild(i)
+				if parameter.Type() != "property_promotion_parameter" {
+					continue
+				}
+
+				if n := findNodeOfType(parameter.ChildByFieldName("name"), "name"); n != nil {
+					*symbols = append(*symbols, w.member(Kind_Property, parameter, n))
+				}
+			}
+		}
+		return
 
 	case "property_declaration":
-		n := findNodeOfType(node, "name")
-		*symbols = append(*symbols, getSymbolFromNode(content, Kind_Property, n))
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			element := node.NamedChild(i)
+			if element.Type() != "property_element" {
+				continue
+			}
+
+			if n := findNodeOfType(element, "name"); n != nil {
+				*symbols = append(*symbols, w.member(Kind_Property, node, n))
+			}
+		}
 		return
 
 	case "const_declaration":
-		n := findNodeOfType(node, "name")
-		*symbols = append(*symbols, getSymbolFromNode(content, Kind_Constant, n))
+		// constants of a class like declaration are not namespaced
+		member := node.Parent() != nil && node.Parent().Type() == "declaration_list"
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			element := node.NamedChild(i)
+			if element.Type() != "const_element" {
+				continue
+			}
+
+			n := findNodeOfType(element, "name")
+			if n == nil {
+				continue
+			}
+
+			if member {
+				*symbols = append(*symbols, w.member(Kind_Constant, node, n))
+			} else {
+				*symbols = append(*symbols, w.declaration(Kind_Constant, node, n))
+			}
+		}
+		return
+
+	case "enum_case":
+		if n := node.ChildByFieldName("name"); n != nil {
+			*symbols = append(*symbols, w.member(Kind_EnumMember, node, n))
+		}
 		return
 
-		// disabled for now because it can't handle deifine($key, $value) calls
-		// case "function_call_expression":
-		// 	if GetNodeText(content, node.Child(0)) == "define" {
-		// 		n := findNodeOfType(node.Child(1), "string")
-		// 		*symbols = append(*symbols, getSymbolFromNode(content, Kind_Constant, n))
-		//
-		// 	}
+	case "function_call_expression":
+		// define($name, ...) declares no constant known before it runs
+		if n := defineName(content, node); n != nil {
+			// define() names are fully qualified wherever it is called
+			symbol := w.member(Kind_Constant, node, n)
+			symbol.FQN = strings.TrimPrefix(symbol.Name, "\\")
+			*symbols = append(*symbols, symbol)
+		}
 	}
 
 	var childrenSymbols []Symbol
 
+	units := hasUnits(node)
+	// statements following a namespace statement without braces are its
+	// children
+	namespace := -1
 	for child := node.Child(0); child != nil; child = child.NextSibling() {
-		WalkTree(content, child, &childrenSymbols)
+		if !units {
+			w.walk(child, &childrenSymbols)
+			continue
+		}
+
+		if child.Type() == "namespace_definition" && child.ChildByFieldName("body") == nil {
+			w.namespace = w.namespaceName(child)
+			w.unit(child, &childrenSymbols)
+			namespace = -1
+			if w.namespace != "" {
+				namespace = len(childrenSymbols) - 1
+			}
+			continue
+		}
+
+		if namespace >= 0 {
+			w.unit(child, &childrenSymbols[namespace].Children)
+			// the namespace spans the statements following it
+			end := child.EndPoint()
+			childrenSymbols[namespace].Range.LineEnd = end.Row
+			childrenSymbols[namespace].Range.OffsetEnd = end.Column
+		} else {
+			w.unit(child, &childrenSymbols)
+		}
 	}
 
-	canHaveChildren := node.Type() == "class_declaration" || node.Type() == "interface_declaration" || node.Type() == "trait_declaration" || node.Type() == "function_definition"
+	canHaveChildren := node.Type() == "class_declaration" || node.Type() == "interface_declaration" || node.Type() == "trait_declaration" || node.Type() == "enum_declaration" || node.Type() == "function_definition"
 
-	if canHaveChildren {
+	// a declaration without a name has no symbol to hold its children
+	if canHaveChildren && len(*symbols) > count {
 		parent := &(*symbols)[len(*symbols)-1]
 		parent.Children = childrenSymbols
 	} else {
@@ -107,16 +336,139 @@ func WalkTree(content string, node *sitter.Node, symbols *[]Symbol) {
 	}
 }
 
+// walkNamespace walks a namespace definition. Its body is walked in the
+// namespace, a definition without a body only adds the namespace symbol.
+func (w *walker) walkNamespace(node *sitter.Node, symbols *[]Symbol) {
+	name := node.ChildByFieldName("name")
+	body := node.ChildByFieldName("body")
+
+	var children []Symbol
+	if body != nil {
+		outer := w.namespace
+		w.namespace = w.namespaceName(node)
+		w.walk(body, &children)
+		w.namespace = outer
+	}
+
+	if name == nil {
+		// namespace { } declares in the global namespace
+		*symbols = append(*symbols, children...)
+		return
+	}
+
+	symbol := w.member(Kind_Namespace, node, name)
+	symbol.Children = children
+	*symbols = append(*symbols, symbol)
+}
+
+func (w *walker) namespaceName(node *sitter.Node) string {
+	if name := node.ChildByFieldName("name"); name != nil {
+		return GetNodeText(w.content, name)
+	}
+
+	return ""
+}
+
+// declaration returns the symbol of node, a class, interface, trait,
+// function or constant named name in the current namespace.
+func (w *walker) declaration(kind uint32, node *sitter.Node, name *sitter.Node) Symbol {
+	symbol := w.member(kind, node, name)
+	symbol.FQN = join(w.namespace, symbol.Name)
+
+	return symbol
+}
+
+// member returns the symbol of node, declaring name.
+func (w *walker) member(kind uint32, node *sitter.Node, name *sitter.Node) Symbol {
+	return getDeclarationSymbol(w.content, kind, node, name)
+}
+
+func (w *walker) extent(node *sitter.Node) sitter.Range {
+	return extent(w.content, node)
+}
+
+// qualify returns symbols of a unit moved from a namespace to another.
+// Symbols are shared, changed ones are copied, those of a namespace keep
+// their own as do those not named in it, like the constants of define().
+func qualify(symbols []Symbol, from string, to string) []Symbol {
+	if len(symbols) == 0 {
+		return symbols
+	}
+
+	qualified := make([]Symbol, len(symbols))
+	for i, symbol := range symbols {
+		if symbol.Kind != Kind_Namespace {
+			if symbol.FQN != "" && symbol.FQN == join(from, symbol.Name) {
+				symbol.FQN = join(to, symbol.Name)
+			}
+			symbol.Children = qualify(symbol.Children, from, to)
+		}
+		qualified[i] = symbol
+	}
+
+	return qualified
+}
+
+// hasUnits tells whether the children of node are units: statements of the
+// document or of a namespace, and members of a class.
+func hasUnits(node *sitter.Node) bool {
+	switch node.Type() {
+	case "program", "declaration_list", "enum_declaration_list":
+		return true
+	case "compound_statement":
+		parent := node.Parent()
+		return parent != nil && parent.Type() == "namespace_definition"
+	}
+
+	return false
+}
+
 func getSymbolFromNode(content string, kind uint32, node *sitter.Node) Symbol {
+	position := positionOf(nodeRange(node))
+
 	return Symbol{
-		Name: GetNodeText(content, node),
-		Kind: kind,
-		Position: Position{
-			LineStart:   node.StartPoint().Row,
-			LineEnd:     node.EndPoint().Row,
-			OffsetStart: node.StartPoint().Column,
-			OffsetEnd:   node.EndPoint().Column,
-		},
+		Name:     GetNodeText(content, node),
+		Kind:     kind,
+		Position: position,
+		Range:    position,
+	}
+}
+
+// getDeclarationSymbol returns the symbol of the declaration node, named by
+// name.
+func getDeclarationSymbol(content string, kind uint32, node *sitter.Node, name *sitter.Node) Symbol {
+	symbol := getSymbolFromNode(content, kind, name)
+	symbol.Range = positionOf(extent(content, node))
+
+	return symbol
+}
+
+// extent returns the range of node along with the doc comment right above
+// it.
+func extent(content string, node *sitter.Node) sitter.Range {
+	r := nodeRange(node)
+
+	comment := node.PrevSibling()
+	if comment == nil || comment.Type() != "comment" || !strings.HasPrefix(GetNodeText(content, comment), "/**") {
+		return r
+	}
+
+	// a blank line separates the comment from the declaration
+	if comment.EndPoint().Row+1 < node.StartPoint().Row {
+		return r
+	}
+
+	r.StartPoint = comment.StartPoint()
+	r.StartByte = comment.StartByte()
+	return r
+}
+
+func positionOf(r sitter.Range) Position {
+	return Position{
+		LineStart:   r.StartPoint.Row,
+		LineEnd:     r.EndPoint.Row,
+		OffsetStart: r.StartPoint.Column,
+		OffsetEnd:   r.EndPoint.Column,
 	}
 }
 
@@ -2,6 +2,7 @@ package treesitter_test
 
 import (
 	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"strings"
 	"testing"
 )
 
@@ -156,7 +157,7 @@ func TestGetSymbols(t *testing.T) {
 			trait Foo {}
 			`,
 			expected: []treesitter.Symbol{
-				{Name: "Foo", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 9, OffsetEnd: 12}},
+				{Name: "Foo", Kind: treesitter.Kind_Struct, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 9, OffsetEnd: 12}},
 			},
 		},
 		"multiple traits": {
@@ -165,8 +166,8 @@ func TestGetSymbols(t *testing.T) {
 			trait Bar {}
 			`,
 			expected: []treesitter.Symbol{
-				{Name: "Foo", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 9, OffsetEnd: 12}},
-				{Name: "Bar", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 9, OffsetEnd: 12}},
+				{Name: "Foo", Kind: treesitter.Kind_Struct, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 9, OffsetEnd: 12}},
+				{Name: "Bar", Kind: treesitter.Kind_Struct, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 9, OffsetEnd: 12}},
 			},
 		},
 		"trait with inheritance": {
@@ -176,8 +177,8 @@ func TestGetSymbols(t *testing.T) {
 			},
 			`,
 			expected: []treesitter.Symbol{
-				{Name: "Foo", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 9, OffsetEnd: 12}, Children: []treesitter.Symbol{
-					{Name: "Bar", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 8, OffsetEnd: 11}},
+				{Name: "Foo", Kind: treesitter.Kind_Struct, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 9, OffsetEnd: 12}, Children: []treesitter.Symbol{
+					{Name: "Bar", Kind: treesitter.Kind_Struct, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 8, OffsetEnd: 11}},
 				}},
 			},
 		},
@@ -188,9 +189,9 @@ func TestGetSymbols(t *testing.T) {
 			},
 			`,
 			expected: []treesitter.Symbol{
-				{Name: "Foo", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 9, OffsetEnd: 12}, Children: []treesitter.Symbol{
-					{Name: "Bar", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 8, OffsetEnd: 11}},
-					{Name: "Baz", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 13, OffsetEnd: 16}},
+				{Name: "Foo", Kind: treesitter.Kind_Struct, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 9, OffsetEnd: 12}, Children: []treesitter.Symbol{
+					{Name: "Bar", Kind: treesitter.Kind_Struct, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 8, OffsetEnd: 11}},
+					{Name: "Baz", Kind: treesitter.Kind_Struct, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 13, OffsetEnd: 16}},
 				}},
 			},
 		},
@@ -222,7 +223,7 @@ func TestGetSymbols(t *testing.T) {
 				{Name: "Foo", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 9, OffsetEnd: 12}, Children: []treesitter.Symbol{
 					{Name: "Bar", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 21, OffsetEnd: 24}},
 					{Name: "Baz", Kind: treesitter.Kind_Interface, Position: treesitter.Position{LineStart: 1, LineEnd: 1, OffsetStart: 36, OffsetEnd: 39}},
-					{Name: "Qux", Kind: treesitter.Kind_Class, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 8, OffsetEnd: 11}},
+					{Name: "Qux", Kind: treesitter.Kind_Struct, Position: treesitter.Position{LineStart: 2, LineEnd: 2, OffsetStart: 8, OffsetEnd: 11}},
 				}},
 			},
 		},
@@ -312,3 +313,236 @@ func TestGetSymbols(t *testing.T) {
 		})
 	}
 }
+
+func TestGetSymbolsInNamespaces(t *testing.T) {
+	tests := map[string]struct {
+		code string
+		// expected are the symbols in order, indented by depth, followed by
+		// their fully qualified name
+		expected []string
+	}{
+		"namespace statement": {
+			code: `<?php
+			namespace App\Models;
+
+			use Foo\Bar;
+
+			class User {
+				public function name() {
+					$x = 1;
+				}
+			}
+
+			function helper() {}
+			const LIMIT = 1;`,
+			expected: []string{
+				`App\Models`,
+				`  User App\Models\User`,
+				`    name`,
+				`      x`,
+				`  helper App\Models\helper`,
+				`  LIMIT App\Models\LIMIT`,
+			},
+		},
+		"multiple namespace statements": {
+			code: `<?php
+			namespace App;
+			class User {}
+			namespace Tests;
+			class UserTest {}`,
+			expected: []string{
+				`App`,
+				`  User App\User`,
+				`Tests`,
+				`  UserTest Tests\UserTest`,
+			},
+		},
+		"braced namespaces": {
+			code: `<?php
+			namespace App {
+				interface Model {}
+			}
+			namespace {
+				function helper() {}
+			}`,
+			expected: []string{
+				`App`,
+				`  Model App\Model`,
+				`helper helper`,
+			},
+		},
+		"class constants are not qualified": {
+			code: `<?php
+			namespace App;
+			class User {
+				const TABLE = 'users';
+			}`,
+			expected: []string{
+				`App`,
+				`  User App\User`,
+				`    TABLE`,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := describeSymbols(treesitter.GetDocumentSymbols(tc.code), "")
+			if strings.Join(actual, "\n") != strings.Join(tc.expected, "\n") {
+				t.Errorf("Expected\n%s\ngot\n%s", strings.Join(tc.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func describeSymbols(symbols []treesitter.Symbol, indent string) []string {
+	var lines []string
+	for _, symbol := range symbols {
+		lines = append(lines, strings.TrimRight(indent+symbol.Name+" "+symbol.FQN, " "))
+		lines = append(lines, describeSymbols(symbol.Children, indent+"  ")...)
+	}
+
+	return lines
+}
+
+func TestGetSymbolsOfModernDeclarations(t *testing.T) {
+	tests := map[string]struct {
+		code     string
+		expected string
+	}{
+		"enum": {
+			code: `<?php
+			enum Suit: string implements HasColor {
+				use Colors;
+				case Hearts = 'H';
+				case Spades;
+			}`,
+			expected: "Enum:Suit(Interface:HasColor Struct:Colors EnumMember:Hearts EnumMember:Spades)",
+		},
+		"enum with constants": {
+			code: `<?php
+			namespace App;
+			enum Suit: string {
+				case Hearts = 'H';
+				const Wild = self::Hearts;
+				public function label(): string { return 'x'; }
+			}`,
+			expected: "Namespace:App(Enum:Suit(EnumMember:Hearts Constant:Wild Method:label))",
+		},
+		"enum with constants among other members": {
+			code: `<?php
+			enum Size {
+				final public const DEFAULT = self::Small;
+				case Small;
+				private static function of($value) { $size = 1; }
+				case Large;
+			}
+			function after() {}`,
+			expected: "Enum:Size(Constant:DEFAULT EnumMember:Small Method:of(Variable:value Variable:size) EnumMember:Large) Function:after",
+		},
+		"readonly class with promoted properties": {
+			code: `<?php
+			readonly class Point {
+				public function __construct(public int $x, private int $y, $scale) {}
+			}`,
+			expected: "Class:Point(Method:__construct(Variable:x Variable:y Variable:scale) Property:x Property:y)",
+		},
+		"typed and grouped properties": {
+			code: `<?php
+			final class Foo {
+				public readonly Bar $bar;
+				public ?int $a = 1, $b;
+				final public const A = 1, B = 2;
+			}`,
+			expected: "Class:Foo(Property:bar Property:a Property:b Constant:A Constant:B)",
+		},
+		"attributes": {
+			code: `<?php
+			#[Attr]
+			class Foo {
+				#[Route('/x')]
+				public function run(): void {}
+			}`,
+			expected: "Class:Foo(Method:run)",
+		},
+		"interface constants and abstract methods": {
+			code: `<?php
+			interface Shape {
+				const SIDES = 0;
+				public function area(): float;
+			}
+			abstract class Square implements Shape {
+				abstract protected function side(): float;
+			}`,
+			expected: "Interface:Shape(Constant:SIDES Method:area) Class:Square(Interface:Shape Method:side)",
+		},
+		"trait": {
+			code: `<?php
+			trait Greets {
+				use Speaks, Waves {
+					Speaks::hello insteadof Waves;
+				}
+			}`,
+			expected: "Struct:Greets(Struct:Speaks Struct:Waves)",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := outline(treesitter.GetDocumentSymbols(tc.code))
+			if actual != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGetSymbolRanges(t *testing.T) {
+	code := `<?php
+namespace App;
+
+/**
+ * A user.
+ */
+#[Entity]
+class User {
+    /** @var string */
+    public $name;
+
+    // not a doc comment
+    public function greet(): string {
+        return 'hi';
+    }
+}
+
+/** Separated by a blank line. */
+
+function helper() {}
+`
+	// start and end rows of the range, then of the position
+	tests := map[string][4]uint32{
+		"App":    {1, 19, 1, 1},
+		"User":   {3, 15, 7, 7},
+		"name":   {8, 9, 9, 9},
+		"greet":  {12, 14, 12, 12},
+		"helper": {19, 19, 19, 19},
+	}
+
+	rows := map[string][4]uint32{}
+	var collect func(symbols []treesitter.Symbol)
+	collect = func(symbols []treesitter.Symbol) {
+		for _, symbol := range symbols {
+			rows[symbol.Name] = [4]uint32{symbol.Range.LineStart, symbol.Range.LineEnd, symbol.Position.LineStart, symbol.Position.LineEnd}
+			collect(symbol.Children)
+		}
+	}
+	collect(treesitter.GetDocumentSymbols(code))
+
+	for name, expected := range tests {
+		t.Run(name, func(t *testing.T) {
+			if rows[name] != expected {
+				t.Errorf("Expected %v, got %v", expected, rows[name])
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package treesitter
+
+import (
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// The PHP grammar does not know the constants of enums, an enum declaring
+// one is cut short by an ERROR and its members end up as statements of the
+// document. Such an enum is parsed again on its own, its constants turned
+// into cases of the same length, so its members are found where they are.
+
+const openingTag = "<?php\n"
+
+// recovers tells whether node holds an enum the grammar cut short, the
+// enum declaration itself or an ERROR starting at its enum keyword.
+func recovers(node *sitter.Node) bool {
+	switch node.Type() {
+	case "enum_declaration":
+		return node.HasError()
+	case "ERROR":
+		return enumKeyword(node) != nil
+	}
+
+	return false
+}
+
+func enumKeyword(node *sitter.Node) *sitter.Node {
+	for child := node.Child(0); child != nil; child = child.NextSibling() {
+		if child.Type() == "enum" {
+			return child
+		}
+	}
+
+	return nil
+}
+
+// constantCase is a constant of an enum rewritten as a case.
+type constantCase struct {
+	// start is where the constant declaration starts, its modifiers
+	// included, name where its name does.
+	start sitter.Point
+	name  sitter.Point
+}
+
+// brokenEnum is an enum the grammar cut short, as it is parsed again.
+type brokenEnum struct {
+	// text is an opening tag line followed by the document up to the end
+	// of the enum, the text before it blanked and its constants rewritten.
+	text      []byte
+	keyword   *sitter.Node
+	end       *sitter.Node
+	constants []constantCase
+	// span is the range the enum actually spans, with the attributes and
+	// doc comment of its declaration.
+	span sitter.Range
+}
+
+// scanEnum finds the end of the enum node holds and rewrites it to be
+// parsed again. It returns false when the end is not found.
+func (w *walker) scanEnum(node *sitter.Node) (*brokenEnum, bool) {
+	keyword := enumKeyword(node)
+	if keyword == nil {
+		return nil, false
+	}
+
+	text := []byte(w.content)
+	var constants []constantCase
+
+	// tokens of the enum body, members start after a brace or a semicolon
+	depth := 0
+	memberStart := false
+	var modifiers []*sitter.Node
+	var constant *constantCase
+	// value is set from the name of a constant to the end of its value,
+	// which cases only have as literals
+	value := false
+	var end *sitter.Node
+	eachLeaf(root(node), keyword.StartByte(), func(leaf *sitter.Node) bool {
+		if leaf.IsMissing() {
+			return true
+		}
+
+		if value && !(leaf.Type() == ";" && depth == 1) {
+			blank(text[leaf.StartByte():leaf.EndByte()])
+		}
+
+		if constant != nil {
+			if leaf.Type() == "name" {
+				constant.name = leaf.StartPoint()
+				constants = append(constants, *constant)
+				value = true
+			}
+			constant = nil
+		}
+
+		switch leaf.Type() {
+		case "{":
+			depth++
+			memberStart = depth == 1
+			return true
+		case "}":
+			depth--
+			if depth == 0 {
+				end = leaf
+				return false
+			}
+			memberStart = depth == 1
+			return true
+		case ";":
+			memberStart = depth == 1
+			modifiers = nil
+			value = value && depth != 1
+			return true
+		}
+
+		if !memberStart {
+			return true
+		}
+
+		switch strings.ToLower(leaf.Type()) {
+		case "public", "protected", "private", "final":
+			modifiers = append(modifiers, leaf)
+			return true
+		case "const":
+			constant = &constantCase{start: leaf.StartPoint()}
+			if len(modifiers) > 0 {
+				constant.start = modifiers[0].StartPoint()
+			}
+			for _, modifier := range modifiers {
+				blank(text[modifier.StartByte():modifier.EndByte()])
+			}
+			copy(text[leaf.StartByte():leaf.EndByte()], "case ")
+		}
+
+		memberStart = false
+		modifiers = nil
+		return true
+	})
+
+	if end == nil {
+		return nil, false
+	}
+
+	// the text before the enum is blanked, on the line after an opening
+	// tag, so positions only move down a row
+	text = text[:end.EndByte()]
+	blank(text[:keyword.StartByte()])
+	text = append([]byte(openingTag), text...)
+
+	span := nodeRange(keyword)
+	if node.Type() == "enum_declaration" {
+		span = w.extent(node)
+	}
+	span.EndPoint = end.EndPoint()
+	span.EndByte = end.EndByte()
+
+	return &brokenEnum{text: text, keyword: keyword, end: end, constants: constants, span: span}, true
+}
+
+// recoverEnum returns the symbol of the enum node holds, with its members,
+// and the range the enum actually spans. It returns false when the enum
+// cannot be recovered.
+func (w *walker) recoverEnum(node *sitter.Node) (Symbol, sitter.Range, bool) {
+	broken, ok := w.scanEnum(node)
+	if !ok {
+		return Symbol{}, sitter.Range{}, false
+	}
+
+	tree, err := ParseDocument(string(broken.text))
+	if err != nil {
+		return Symbol{}, sitter.Range{}, false
+	}
+	enum := findNodeOfType(tree.RootNode(), "enum_declaration")
+	if enum == nil {
+		return Symbol{}, sitter.Range{}, false
+	}
+
+	recovered := &walker{content: string(broken.text), declarations: w.declarations, namespace: w.namespace, reparsed: true}
+	var symbols []Symbol
+	recovered.walk(enum, &symbols)
+	if len(symbols) != 1 {
+		return Symbol{}, sitter.Range{}, false
+	}
+
+	symbol := moveSymbols(symbols, sitter.Point{Row: 1}, sitter.Point{})[0]
+	for i, member := range symbol.Children {
+		for _, constant := range broken.constants {
+			if member.Kind != Kind_EnumMember || member.Position.LineStart != constant.name.Row || member.Position.OffsetStart != constant.name.Column {
+				continue
+			}
+
+			member.Kind = Kind_Constant
+			if member.Range.LineStart > constant.start.Row || (member.Range.LineStart == constant.start.Row && member.Range.OffsetStart > constant.start.Column) {
+				member.Range.LineStart = constant.start.Row
+				member.Range.OffsetStart = constant.start.Column
+			}
+			symbol.Children[i] = member
+		}
+	}
+
+	// the attributes and doc comment of the declaration are not parsed again
+	if node.Type() == "enum_declaration" {
+		symbol.Range.LineStart = broken.span.StartPoint.Row
+		symbol.Range.OffsetStart = broken.span.StartPoint.Column
+	}
+
+	return symbol, broken.span, true
+}
+
+// root returns the root of the tree of node. Parents are only looked up
+// from nodes with a width, those of missing nodes may be wrong.
+func root(node *sitter.Node) *sitter.Node {
+	for parent := node.Parent(); parent != nil; parent = node.Parent() {
+		node = parent
+	}
+
+	return node
+}
+
+// eachLeaf calls fn with the tokens of node ending after from, in order,
+// until it returns false.
+func eachLeaf(node *sitter.Node, from uint32, fn func(leaf *sitter.Node) bool) bool {
+	if node.EndByte() <= from {
+		return true
+	}
+
+	if node.ChildCount() == 0 {
+		return fn(node)
+	}
+
+	for child := node.Child(0); child != nil; child = child.NextSibling() {
+		if !eachLeaf(child, from, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// blank replaces text with spaces, keeping its line breaks.
+func blank(text []byte) {
+	for i, c := range text {
+		if c != '\n' && c != '\r' {
+			text[i] = ' '
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package treesitter
+
+import (
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Imports are the namespace and use statements in scope at a position of a
+// document. Names are fully qualified, without the leading backslash, and
+// aliases are keyed in lower case as PHP compares them case insensitively.
+type Imports struct {
+	Namespace string
+	Classes   map[string]string
+	Functions map[string]string
+	Constants map[string]string
+}
+
+func newImports(namespace string) Imports {
+	return Imports{
+		Namespace: namespace,
+		Classes:   map[string]string{},
+		Functions: map[string]string{},
+		Constants: map[string]string{},
+	}
+}
+
+// GetImports returns the imports in scope at row, those of the namespace
+// declaration holding it.
+func GetImports(content string, root *sitter.Node, row uint32) Imports {
+	imports := newImports("")
+	collectImports(content, root, row, &imports)
+
+	return imports
+}
+
+func collectImports(content string, node *sitter.Node, row uint32, imports *Imports) {
+	for child := node.Child(0); child != nil; child = child.NextSibling() {
+		switch child.Type() {
+		case "namespace_definition":
+			namespace := ""
+			if name := child.ChildByFieldName("name"); name != nil {
+				namespace = GetNodeText(content, name)
+			}
+
+			body := child.ChildByFieldName("body")
+			if body == nil {
+				// namespace Foo; lasts until the next namespace statement
+				if child.StartPoint().Row > row {
+					return
+				}
+				*imports = newImports(namespace)
+				continue
+			}
+
+			if child.StartPoint().Row <= row && row <= child.EndPoint().Row {
+				*imports = newImports(namespace)
+				collectImports(content, body, row, imports)
+				return
+			}
+
+		case "namespace_use_declaration":
+			addUseDeclaration(content, child, imports)
+		}
+	}
+}
+
+// addUseDeclaration adds the names imported by a use statement, group uses
+// included: use A\{B, function c, const D as E};
+func addUseDeclaration(content string, node *sitter.Node, imports *Imports) {
+	kind := useKind(node, "")
+	prefix := ""
+
+	for child := node.Child(0); child != nil; child = child.NextSibling() {
+		switch child.Type() {
+		case "namespace_name":
+			prefix = GetNodeText(content, child) + "\\"
+		case "namespace_use_clause":
+			addUseClause(content, child, "", kind, imports)
+		case "namespace_use_group":
+			for clause := child.Child(0); clause != nil; clause = clause.NextSibling() {
+				if clause.Type() == "namespace_use_group_clause" {
+					addUseClause(content, clause, prefix, useKind(clause, kind), imports)
+				}
+			}
+		}
+	}
+}
+
+// useKind returns function or const when node starts with that keyword, and
+// fallback otherwise.
+func useKind(node *sitter.Node, fallback string) string {
+	for child := node.Child(0); child != nil && !child.IsNamed(); child = child.NextSibling() {
+		if child.Type() == "function" || child.Type() == "const" {
+			return child.Type()
+		}
+	}
+
+	return fallback
+}
+
+func addUseClause(content string, clause *sitter.Node, prefix string, kind string, imports *Imports) {
+	name := ""
+	alias := ""
+	for i := 0; i < int(clause.NamedChildCount()); i++ {
+		child := clause.NamedChild(i)
+		switch child.Type() {
+		case "namespace_aliasing_clause":
+			if n := findNodeOfType(child, "name"); n != nil {
+				alias = GetNodeText(content, n)
+			}
+		case "qualified_name", "namespace_name", "name":
+			name = GetNodeText(content, child)
+		}
+	}
+
+	name = strings.TrimPrefix(prefix+name, "\\")
+	if name == "" {
+		return
+	}
+
+	if alias == "" {
+		alias = name[strings.LastIndex(name, "\\")+1:]
+	}
+
+	switch kind {
+	case "function":
+		imports.Functions[strings.ToLower(alias)] = name
+	case "const":
+		// constants are case sensitive
+		imports.Constants[alias] = name
+	default:
+		imports.Classes[strings.ToLower(alias)] = name
+	}
+}
+
+// Qualify returns the fully qualified name of a class name as written at a
+// position with these imports: fully qualified names are kept, the first
+// segment of other names is resolved through the use statements or the
+// current namespace.
+func (i Imports) Qualify(name string) string {
+	if strings.HasPrefix(name, "\\") {
+		return name[1:]
+	}
+
+	if strings.HasPrefix(strings.ToLower(name), "namespace\\") {
+		return join(i.Namespace, name[len("namespace\\"):])
+	}
+
+	first, rest, qualified := strings.Cut(name, "\\")
+	if imported, ok := i.Classes[strings.ToLower(first)]; ok {
+		if qualified {
+			return imported + "\\" + rest
+		}
+		return imported
+	}
+
+	return join(i.Namespace, name)
+}
+
+func join(namespace string, name string) string {
+	if namespace == "" {
+		return name
+	}
+
+	return namespace + "\\" + name
+}
@@ -0,0 +1,98 @@
+package treesitter_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"reflect"
+	"testing"
+)
+
+func TestGetImports(t *testing.T) {
+	code := `<?php
+namespace App\Http;
+
+use App\Models\User;
+use App\Models\{Post, Comment as Reply, function published};
+use function App\Support\helper;
+use const App\Support\VERSION;
+use Foo\Bar as Baz, Other;
+
+class Controller {}
+
+namespace App\Console;
+
+use App\Models\Post as Article;
+`
+	tree, err := treesitter.ParseDocument(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		row      uint32
+		expected treesitter.Imports
+	}{
+		"first namespace": {
+			row: 9,
+			expected: treesitter.Imports{
+				Namespace: `App\Http`,
+				Classes: map[string]string{
+					"user":  `App\Models\User`,
+					"post":  `App\Models\Post`,
+					"reply": `App\Models\Comment`,
+					"baz":   `Foo\Bar`,
+					"other": `Other`,
+				},
+				Functions: map[string]string{
+					"published": `App\Models\published`,
+					"helper":    `App\Support\helper`,
+				},
+				Constants: map[string]string{
+					"VERSION": `App\Support\VERSION`,
+				},
+			},
+		},
+		"second namespace": {
+			row: 13,
+			expected: treesitter.Imports{
+				Namespace: `App\Console`,
+				Classes:   map[string]string{"article": `App\Models\Post`},
+				Functions: map[string]string{},
+				Constants: map[string]string{},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := treesitter.GetImports(code, tree.RootNode(), tt.row)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestImportsQualify(t *testing.T) {
+	imports := treesitter.Imports{
+		Namespace: `App\Http`,
+		Classes:   map[string]string{"user": `App\Models\User`, "models": `App\Models`},
+	}
+
+	tests := map[string]string{
+		`User`:             `App\Models\User`,
+		`user`:             `App\Models\User`,
+		`Models\Post`:      `App\Models\Post`,
+		`Request`:          `App\Http\Request`,
+		`Middleware\Auth`:  `App\Http\Middleware\Auth`,
+		`\DateTime`:        `DateTime`,
+		`namespace\Kernel`: `App\Http\Kernel`,
+	}
+
+	for name, expected := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := imports.Qualify(name); got != expected {
+				t.Errorf("Expected %v, got %v", expected, got)
+			}
+		})
+	}
+}
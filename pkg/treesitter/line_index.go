@@ -0,0 +1,187 @@
+package treesitter
+
+import (
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// LineIndex maps between byte offsets in a document and LSP positions.
+// Tree-sitter works with bytes while the client counts characters in the
+// negotiated position encoding, UTF-16 code units unless told otherwise.
+type LineIndex struct {
+	content string
+	// lines holds the byte offset of the start of every line, lines end
+	// with "\n", "\r\n" or "\r"
+	lines []int
+	// rows holds the byte offset of the start of every row of a tree,
+	// tree-sitter only ends rows with "\n"
+	rows []int
+}
+
+func NewLineIndex(content string) *LineIndex {
+	newlines := strings.Count(content, "\n")
+	lines := make([]int, 1, newlines+1)
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' || (content[i] == '\r' && (i+1 == len(content) || content[i+1] != '\n')) {
+			lines = append(lines, i+1)
+		}
+	}
+
+	// rows only differ from lines when one ends with a lone "\r"
+	rows := lines
+	if len(lines) != newlines+1 {
+		rows = make([]int, 1, newlines+1)
+		for i := 0; i < len(content); i++ {
+			if content[i] == '\n' {
+				rows = append(rows, i+1)
+			}
+		}
+	}
+
+	return &LineIndex{content: content, lines: lines, rows: rows}
+}
+
+// LineCount returns the number of lines of the document.
+func (l *LineIndex) LineCount() int {
+	return len(l.lines)
+}
+
+// Line returns the text of a line without its line terminator, or an empty
+// string when the document has no such line.
+func (l *LineIndex) Line(line int) string {
+	if line < 0 || line >= len(l.lines) {
+		return ""
+	}
+
+	return l.line(line)
+}
+
+// line returns the text of a line without its line terminator.
+func (l *LineIndex) line(line int) string {
+	start := l.lines[line]
+	end := len(l.content)
+	if line+1 < len(l.lines) {
+		end = l.lines[line+1]
+		if l.content[end-1] == '\n' {
+			end--
+		}
+	}
+
+	return strings.TrimSuffix(l.content[start:end], "\r")
+}
+
+// Offset returns the byte offset of pos. Positions past the end of a line or
+// of the document are clamped to it, as the specification asks.
+func (l *LineIndex) Offset(pos lsp.Position, encoding string) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(l.lines) {
+		return len(l.content)
+	}
+
+	return l.lines[pos.Line] + byteColumn(l.line(pos.Line), pos.Character, encoding)
+}
+
+// Point returns the tree-sitter point of pos.
+func (l *LineIndex) Point(pos lsp.Position, encoding string) sitter.Point {
+	return l.PointAt(l.Offset(pos, encoding))
+}
+
+// PointAt returns the tree-sitter point of a byte offset.
+func (l *LineIndex) PointAt(offset int) sitter.Point {
+	row := sort.Search(len(l.rows), func(i int) bool { return l.rows[i] > offset }) - 1
+
+	return sitter.Point{Row: uint32(row), Column: uint32(offset - l.rows[row])}
+}
+
+// Position returns the LSP position of a tree-sitter point.
+func (l *LineIndex) Position(point sitter.Point, encoding string) lsp.Position {
+	row := int(point.Row)
+	if row >= len(l.rows) {
+		return lsp.Position{Line: row, Character: int(point.Column)}
+	}
+
+	// the point is clamped to its row, then to the line it falls in
+	end := len(l.content)
+	if row+1 < len(l.rows) {
+		end = l.rows[row+1] - 1
+	}
+	offset := l.rows[row] + int(point.Column)
+	if offset > end {
+		offset = end
+	}
+
+	line := sort.Search(len(l.lines), func(i int) bool { return l.lines[i] > offset }) - 1
+	text := l.line(line)
+	column := offset - l.lines[line]
+	if column > len(text) {
+		column = len(text)
+	}
+
+	return lsp.Position{Line: line, Character: CharacterCount(text[:column], encoding)}
+}
+
+// PositionAt returns the LSP position of a byte offset.
+func (l *LineIndex) PositionAt(offset int, encoding string) lsp.Position {
+	return l.Position(l.PointAt(offset), encoding)
+}
+
+// CharacterCount returns the length of text in the units of encoding.
+func CharacterCount(text string, encoding string) int {
+	switch encoding {
+	case lsp.PositionEncodingUTF8:
+		return len(text)
+	case lsp.PositionEncodingUTF32:
+		return utf8.RuneCountInString(text)
+	}
+
+	count := 0
+	for _, r := range text {
+		count += utf16Length(r)
+	}
+
+	return count
+}
+
+// byteColumn returns the byte offset in line of a character offset counted
+// in encoding, clamped to the length of the line.
+func byteColumn(line string, character int, encoding string) int {
+	if encoding == lsp.PositionEncodingUTF8 {
+		if character > len(line) {
+			return len(line)
+		}
+		// never split a multibyte character
+		for character > 0 && character < len(line) && !utf8.RuneStart(line[character]) {
+			character--
+		}
+		return character
+	}
+
+	count := 0
+	for i, r := range line {
+		if count >= character {
+			return i
+		}
+
+		if encoding == lsp.PositionEncodingUTF32 {
+			count++
+		} else {
+			count += utf16Length(r)
+		}
+	}
+
+	return len(line)
+}
+
+func utf16Length(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
@@ -0,0 +1,111 @@
+package treesitter_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+func TestLineIndexOffset(t *testing.T) {
+	content := "<?php\n$greeting = 'مرحبا';\n$emoji = '😀x';\r\n$end = 1;"
+
+	tests := map[string]struct {
+		pos      lsp.Position
+		encoding string
+		expected int
+	}{
+		"start of document":             {lsp.Position{Line: 0, Character: 0}, lsp.PositionEncodingUTF16, 0},
+		"newlines are counted":          {lsp.Position{Line: 1, Character: 0}, lsp.PositionEncodingUTF16, 6},
+		"arabic in utf-16":              {lsp.Position{Line: 1, Character: 18}, lsp.PositionEncodingUTF16, 6 + 13 + 10},
+		"arabic in utf-8":               {lsp.Position{Line: 1, Character: 23}, lsp.PositionEncodingUTF8, 6 + 23},
+		"emoji is two utf-16 units":     {lsp.Position{Line: 2, Character: 12}, lsp.PositionEncodingUTF16, 32 + 10 + 4},
+		"emoji is one utf-32 unit":      {lsp.Position{Line: 2, Character: 11}, lsp.PositionEncodingUTF32, 32 + 10 + 4},
+		"past the end of line clamps":   {lsp.Position{Line: 2, Character: 100}, lsp.PositionEncodingUTF16, 32 + 17},
+		"past the end of file clamps":   {lsp.Position{Line: 10, Character: 0}, lsp.PositionEncodingUTF16, len(content)},
+		"utf-8 inside a multibyte rune": {lsp.Position{Line: 1, Character: 14}, lsp.PositionEncodingUTF8, 6 + 13},
+	}
+
+	lines := treesitter.NewLineIndex(content)
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := lines.Offset(tt.pos, tt.encoding)
+			if actual != tt.expected {
+				t.Errorf("Expected offset %d, got %d", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLineIndexPosition(t *testing.T) {
+	content := "<?php\n$greeting = 'مرحبا';\n$emoji = '😀x';"
+
+	tests := map[string]struct {
+		offset   int
+		encoding string
+		expected lsp.Position
+	}{
+		"ascii":           {8, lsp.PositionEncodingUTF16, lsp.Position{Line: 1, Character: 2}},
+		"after arabic":    {6 + 23, lsp.PositionEncodingUTF16, lsp.Position{Line: 1, Character: 18}},
+		"after arabic u8": {6 + 23, lsp.PositionEncodingUTF8, lsp.Position{Line: 1, Character: 23}},
+		"after emoji":     {32 + 14, lsp.PositionEncodingUTF16, lsp.Position{Line: 2, Character: 12}},
+		"after emoji u32": {32 + 14, lsp.PositionEncodingUTF32, lsp.Position{Line: 2, Character: 11}},
+	}
+
+	lines := treesitter.NewLineIndex(content)
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := lines.PositionAt(tt.offset, tt.encoding)
+			if actual != tt.expected {
+				t.Errorf("Expected position %v, got %v", tt.expected, actual)
+			}
+
+			if offset := lines.Offset(actual, tt.encoding); offset != tt.offset {
+				t.Errorf("Expected position %v to map back to %d, got %d", actual, tt.offset, offset)
+			}
+		})
+	}
+}
+
+func TestLineIndexLineTerminators(t *testing.T) {
+	// tree-sitter only starts a row after "\n", LSP lines also end with a
+	// lone "\r"
+	content := "<?php\r$a = 1;\r\n$b = 2;\n$c = 3;\r"
+
+	tests := map[string]struct {
+		pos    lsp.Position
+		offset int
+		point  sitter.Point
+	}{
+		"after a lone cr":     {lsp.Position{Line: 1, Character: 2}, 8, sitter.Point{Row: 0, Column: 8}},
+		"after a cr lf":       {lsp.Position{Line: 2, Character: 0}, 15, sitter.Point{Row: 1, Column: 0}},
+		"after a lf":          {lsp.Position{Line: 3, Character: 3}, 26, sitter.Point{Row: 2, Column: 3}},
+		"end of a cr lf line": {lsp.Position{Line: 1, Character: 7}, 13, sitter.Point{Row: 0, Column: 13}},
+		"after a trailing cr": {lsp.Position{Line: 4, Character: 0}, 31, sitter.Point{Row: 2, Column: 8}},
+	}
+
+	lines := treesitter.NewLineIndex(content)
+	if lines.LineCount() != 5 {
+		t.Errorf("Expected 5 lines, got %d", lines.LineCount())
+	}
+	if line := lines.Line(1); line != "$a = 1;" {
+		t.Errorf("Expected line %q, got %q", "$a = 1;", line)
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if offset := lines.Offset(tt.pos, lsp.PositionEncodingUTF16); offset != tt.offset {
+				t.Errorf("Expected offset %d, got %d", tt.offset, offset)
+			}
+
+			if point := lines.PointAt(tt.offset); point != tt.point {
+				t.Errorf("Expected point %v, got %v", tt.point, point)
+			}
+
+			if pos := lines.Position(tt.point, lsp.PositionEncodingUTF16); pos != tt.pos {
+				t.Errorf("Expected position %v, got %v", tt.pos, pos)
+			}
+		})
+	}
+}
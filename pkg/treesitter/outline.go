@@ -0,0 +1,197 @@
+package treesitter
+
+import (
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Outline holds the symbols of a document along with those of each of its
+// units, the statements and class members. Once the document is edited,
+// only the units the edits touched are walked again.
+type Outline struct {
+	symbols []Symbol
+	units   []unit
+	changed []sitter.Range
+}
+
+// unit is a node whose symbols only depend on its own content and on the
+// type of its parent, constants are members in a class and declarations
+// outside of it.
+type unit struct {
+	kind      string
+	parent    string
+	start     sitter.Point
+	startByte uint32
+	endByte   uint32
+	symbols   []Symbol
+	// namespace is the one the unit was walked in.
+	namespace string
+	// nested is how many units walked within it precede it.
+	nested int
+}
+
+type unitKey struct {
+	kind      string
+	parent    string
+	startByte uint32
+	endByte   uint32
+}
+
+// NewOutline walks the whole tree of content.
+func NewOutline(content string, tree *sitter.Tree) *Outline {
+	w := &walker{content: content}
+
+	var symbols []Symbol
+	w.walk(tree.RootNode(), &symbols)
+
+	return &Outline{
+		symbols: symbols,
+		units:   w.units,
+		changed: []sitter.Range{nodeRange(tree.RootNode())},
+	}
+}
+
+// Update returns the outline of tree, parsed from the tree of o edited by
+// edits in order. Units the edits did not touch keep their symbols, moved
+// to where the edits put them.
+func (o *Outline) Update(content string, tree *sitter.Tree, edits []sitter.EditInput) *Outline {
+	units := make([]unit, len(o.units))
+	moved := make(map[unitKey]int, len(o.units))
+	for i, u := range o.units {
+		if u, ok := u.moved(edits); ok {
+			units[i] = u
+			moved[unitKey{kind: u.kind, parent: u.parent, startByte: u.startByte, endByte: u.endByte}] = i
+		}
+	}
+
+	w := &walker{content: content}
+	w.reuse = func(node *sitter.Node, extent sitter.Range) ([]Symbol, bool) {
+		// the same text may not parse the same where it holds errors, but
+		// an enum the grammar cuts short is parsed again on its own
+		if node.HasError() && !recovers(node) {
+			return nil, false
+		}
+
+		i, ok := moved[unitKey{kind: node.Type(), parent: parentType(node), startByte: extent.StartByte, endByte: extent.EndByte}]
+		if !ok {
+			return nil, false
+		}
+
+		// a namespace statement before the unit may have been renamed
+		for _, nested := range units[i-units[i].nested : i] {
+			w.units = append(w.units, nested.in(units[i].namespace, w.namespace))
+		}
+		return units[i].in(units[i].namespace, w.namespace).symbols, true
+	}
+
+	var symbols []Symbol
+	w.walk(tree.RootNode(), &symbols)
+
+	return &Outline{symbols: symbols, units: w.units, changed: w.changed}
+}
+
+// Symbols returns the symbols of the document, shared with the outline.
+func (o *Outline) Symbols() []Symbol {
+	return o.symbols
+}
+
+// Changed returns the ranges of the document whose symbols were extracted
+// again by the last update, the whole document for a new outline. They hold
+// every syntax change the edits made.
+func (o *Outline) Changed() []sitter.Range {
+	return o.changed
+}
+
+// moved returns u where edits applied in order put it, false when one of
+// them changes its content. Text inserted right before or after it may
+// still make it part of another node, its symbols are then only reused if a
+// node of the same type, in a parent of the same type, has the moved range.
+func (u unit) moved(edits []sitter.EditInput) (unit, bool) {
+	start := u.start
+	for _, edit := range edits {
+		if edit.StartIndex < u.endByte && u.startByte < edit.OldEndIndex {
+			return u, false
+		}
+
+		if u.startByte < edit.StartIndex {
+			continue
+		}
+
+		delta := int64(edit.NewEndIndex) - int64(edit.OldEndIndex)
+		u.startByte = uint32(int64(u.startByte) + delta)
+		u.endByte = uint32(int64(u.endByte) + delta)
+		start = movePoint(start, edit.OldEndPoint, edit.NewEndPoint)
+	}
+
+	u.symbols = moveSymbols(u.symbols, u.start, start)
+	u.start = start
+	return u, true
+}
+
+// in returns u, walked in the namespace from, walked in the namespace to
+// instead. Units nested in a namespace of their own keep it.
+func (u unit) in(from string, to string) unit {
+	if from == to || u.namespace != from {
+		return u
+	}
+
+	u.symbols = qualify(u.symbols, from, to)
+	u.namespace = to
+	return u
+}
+
+// moveSymbols moves symbols of a unit starting at from to a unit starting
+// at to. Only the points on the first row of the unit change column.
+func moveSymbols(symbols []Symbol, from sitter.Point, to sitter.Point) []Symbol {
+	if from == to || len(symbols) == 0 {
+		return symbols
+	}
+
+	moved := make([]Symbol, len(symbols))
+	for i, symbol := range symbols {
+		symbol.Position = movePosition(symbol.Position, from, to)
+		symbol.Range = movePosition(symbol.Range, from, to)
+		symbol.Children = moveSymbols(symbol.Children, from, to)
+		moved[i] = symbol
+	}
+
+	return moved
+}
+
+func movePosition(position Position, from sitter.Point, to sitter.Point) Position {
+	start := movePoint(sitter.Point{Row: position.LineStart, Column: position.OffsetStart}, from, to)
+	end := movePoint(sitter.Point{Row: position.LineEnd, Column: position.OffsetEnd}, from, to)
+
+	return Position{
+		LineStart:   start.Row,
+		LineEnd:     end.Row,
+		OffsetStart: start.Column,
+		OffsetEnd:   end.Column,
+	}
+}
+
+// movePoint moves point, at or after from, as from moves to to.
+func movePoint(point sitter.Point, from sitter.Point, to sitter.Point) sitter.Point {
+	if point.Row == from.Row {
+		return sitter.Point{Row: to.Row, Column: point.Column - from.Column + to.Column}
+	}
+
+	return sitter.Point{Row: point.Row - from.Row + to.Row, Column: point.Column}
+}
+
+// parentType returns the type of the parent of node, empty for the root.
+func parentType(node *sitter.Node) string {
+	if parent := node.Parent(); parent != nil {
+		return parent.Type()
+	}
+
+	return ""
+}
+
+func nodeRange(node *sitter.Node) sitter.Range {
+	return sitter.Range{
+		StartPoint: node.StartPoint(),
+		EndPoint:   node.EndPoint(),
+		StartByte:  node.StartByte(),
+		EndByte:    node.EndByte(),
+	}
+}
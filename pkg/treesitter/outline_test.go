@@ -0,0 +1,129 @@
+package treesitter_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"reflect"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+func TestOutlineUpdate(t *testing.T) {
+	content := "<?php\nclass Foo {\n    public function a() {\n        $x = 1;\n    }\n\n    public function b() {\n        $y = 2;\n    }\n}\n\nfunction helper() {\n    $z = 3;\n}\n"
+	change := func(line, start, endLine, end int, text string) lsp.TextDocumentContentChangeEvent {
+		return lsp.TextDocumentContentChangeEvent{
+			Range: &lsp.Range{Start: lsp.Position{Line: line, Character: start}, End: lsp.Position{Line: endLine, Character: end}},
+			Text:  text,
+		}
+	}
+
+	tests := map[string]struct {
+		// content is edited instead of the class and function when set
+		content string
+		changes []lsp.TextDocumentContentChangeEvent
+		// changed are the start and end rows of the changed ranges
+		changed [][2]uint32
+	}{
+		"a variable added to a method": {
+			changes: []lsp.TextDocumentContentChangeEvent{change(3, 15, 3, 15, " $w = 4;")},
+			changed: [][2]uint32{{2, 4}},
+		},
+		"lines inserted before everything": {
+			changes: []lsp.TextDocumentContentChangeEvent{change(1, 0, 1, 0, "$top = 0;\n\n")},
+			changed: [][2]uint32{{1, 1}},
+		},
+		"a method renamed on the line of another": {
+			changes: []lsp.TextDocumentContentChangeEvent{change(6, 20, 6, 21, "c"), change(3, 8, 3, 10, "$xx")},
+			changed: [][2]uint32{{2, 4}, {6, 8}},
+		},
+		"a class renamed": {
+			changes: []lsp.TextDocumentContentChangeEvent{change(1, 6, 1, 9, "Bar")},
+			changed: [][2]uint32{{1, 9}},
+		},
+		"a function removed": {
+			changes: []lsp.TextDocumentContentChangeEvent{change(10, 0, 13, 1, "")},
+			changed: [][2]uint32{},
+		},
+		"a doc comment added to a method": {
+			content: "<?php\nclass Foo {\n    public function a() {}\n}\n",
+			changes: []lsp.TextDocumentContentChangeEvent{change(2, 0, 2, 0, "    /** A. */\n")},
+			changed: [][2]uint32{{2, 2}, {2, 3}},
+		},
+		"a doc comment edited": {
+			content: "<?php\n/** Old. */\nfunction f() {}\n\nfunction g() {}\n",
+			changes: []lsp.TextDocumentContentChangeEvent{change(1, 4, 1, 7, "New")},
+			changed: [][2]uint32{{1, 1}, {1, 2}},
+		},
+		"a namespace renamed": {
+			content: "<?php\nnamespace App;\n\nclass Foo {\n    public function a() {}\n}\n",
+			changes: []lsp.TextDocumentContentChangeEvent{change(1, 10, 1, 13, "Lib")},
+			changed: [][2]uint32{{1, 1}},
+		},
+		"a constant moved into a class": {
+			content: "<?php\nnamespace A;\nclass C {\n}\nconst X = 1;\n\n",
+			changes: []lsp.TextDocumentContentChangeEvent{change(5, 0, 5, 0, "}"), change(3, 0, 3, 1, "")},
+			changed: [][2]uint32{{4, 4}, {5, 5}},
+		},
+		"a constant moved out of a class": {
+			content: "<?php\nnamespace A;\nclass C {\n\nconst X = 1;\n}\n",
+			changes: []lsp.TextDocumentContentChangeEvent{change(5, 0, 5, 1, ""), change(3, 0, 3, 0, "}")},
+			changed: [][2]uint32{{3, 3}, {4, 4}},
+		},
+		"a method of an enum with constants renamed": {
+			content: "<?php\nenum Suit {\n    case Hearts;\n    const Wild = self::Hearts;\n    public function a() {}\n}\n\nfunction helper() {}\n",
+			changes: []lsp.TextDocumentContentChangeEvent{change(4, 20, 4, 21, "b")},
+			changed: [][2]uint32{{1, 5}},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			text := content
+			if tt.content != "" {
+				text = tt.content
+			}
+			tree, _ := treesitter.ParseDocument(text)
+			outline := treesitter.NewOutline(text, tree)
+
+			edited := tree.Copy()
+			var edits []sitter.EditInput
+			for _, change := range tt.changes {
+				var edit sitter.EditInput
+				text, edit = treesitter.ApplyChange(text, change, lsp.PositionEncodingUTF16)
+				edited.Edit(edit)
+				edits = append(edits, edit)
+			}
+
+			newTree, err := treesitter.ParseDocumentIncremental(edited, text)
+			if err != nil {
+				t.Fatalf("Error reparsing document: %s", err)
+			}
+			updated := outline.Update(text, newTree, edits)
+
+			expected := treesitter.GetTreeSymbols(text, newTree)
+			if !reflect.DeepEqual(updated.Symbols(), expected) {
+				t.Errorf("Expected %v, got %v", expected, updated.Symbols())
+			}
+
+			declarations := treesitter.GetDeclarationSymbols(text, newTree)
+			if got := treesitter.Declarations(updated.Symbols()); !reflect.DeepEqual(got, declarations) {
+				t.Errorf("Expected declarations %v, got %v", declarations, got)
+			}
+
+			changed := [][2]uint32{}
+			for _, r := range updated.Changed() {
+				changed = append(changed, [2]uint32{r.StartPoint.Row, r.EndPoint.Row})
+			}
+			if !reflect.DeepEqual(changed, tt.changed) {
+				t.Errorf("Expected changed rows %v, got %v", tt.changed, changed)
+			}
+
+			// the updated outline is reused by the next change
+			again := updated.Update(text, newTree, nil)
+			if !reflect.DeepEqual(again.Symbols(), expected) || len(again.Changed()) != 0 {
+				t.Errorf("Expected an unchanged document to keep its symbols, got %v", again.Symbols())
+			}
+		})
+	}
+}
@@ -3,52 +3,45 @@ package treesitter
 import (
 	"ahmedash95/php-lsp-server/pkg/logger"
 	"ahmedash95/php-lsp-server/pkg/lsp"
-	"fmt"
-	"strings"
 
 	sitter "github.com/smacker/go-tree-sitter"
 )
 
+// LinePositionToIndex returns the byte offset of a client position, the
+// character being counted in UTF-16 code units.
 func LinePositionToIndex(content string, pos lsp.Position) int {
-	// split content by newline
-	lines := strings.Split(content, "\n")
-	// iterate over each line and count the number of characters
-	charCount := 0
-	for i, line := range lines {
-		if i == pos.Line {
-			break
-		}
-
-		charCount += len(line)
-	}
-	// once we reach the line number, we can calculate the offset
-	offset := charCount + pos.Character
-	// then we get the index of the character in the string
-
-	return offset
+	return NewLineIndex(content).Offset(pos, lsp.DefaultPositionEncoding)
 }
 
+// GetNodeAtPosition returns the deepest node at pos, where pos.Character is a
+// byte offset in the line as tree-sitter counts it. Client positions have to
+// be converted with a LineIndex first.
 func GetNodeAtPosition(content string, pos lsp.Position) *sitter.Node {
 	ast, err := ParseDocument(content)
 	if err != nil {
 		return nil
 	}
-	root := ast.RootNode()
 
+	return NodeAt(content, ast.RootNode(), pos)
+}
+
+// NodeAt returns the deepest node below root at pos, counted like
+// GetNodeAtPosition counts it.
+func NodeAt(content string, root *sitter.Node, pos lsp.Position) *sitter.Node {
 	node := walkTreeToPosition(root, pos)
 
 	if node == nil {
 		return nil
 	}
 
-	fmt.Printf("GetNodeAtPosition: %s\n", node.Type())
+	logger.Debugf("GetNodeAtPosition: %s", node.Type())
 
 	switch node.Type() {
 	}
 
 	str := GetNodeText(content, node)
 
-	logger.GetLogger().Printf("Node of type %s at position: line %d at char %d for content %s", node.Type(), pos.Line, pos.Character, str)
+	logger.Debugf("Node of type %s at position: line %d at char %d for content %s", node.Type(), pos.Line, pos.Character, str)
 
 	return node
 }
@@ -0,0 +1,47 @@
+package treesitter
+
+import (
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// ApplyChange applies a ranged content change to content, the range being
+// expressed in the given position encoding. It returns the new content and
+// the edit that has to be applied to the tree of the old content before
+// reparsing it incrementally.
+func ApplyChange(content string, change lsp.TextDocumentContentChangeEvent, encoding string) (string, sitter.EditInput) {
+	lines := NewLineIndex(content)
+
+	start := lines.Offset(change.Range.Start, encoding)
+	end := lines.Offset(change.Range.End, encoding)
+	if end < start {
+		start, end = end, start
+	}
+
+	startPoint := lines.PointAt(start)
+	edit := sitter.EditInput{
+		StartIndex:  uint32(start),
+		OldEndIndex: uint32(end),
+		NewEndIndex: uint32(start + len(change.Text)),
+		StartPoint:  startPoint,
+		OldEndPoint: lines.PointAt(end),
+		NewEndPoint: pointAfter(startPoint, change.Text),
+	}
+
+	return content[:start] + change.Text + content[end:], edit
+}
+
+// pointAfter returns the point where text ends once inserted at start.
+func pointAfter(start sitter.Point, text string) sitter.Point {
+	rows := strings.Count(text, "\n")
+	if rows == 0 {
+		return sitter.Point{Row: start.Row, Column: start.Column + uint32(len(text))}
+	}
+
+	return sitter.Point{
+		Row:    start.Row + uint32(rows),
+		Column: uint32(len(text) - (strings.LastIndexByte(text, '\n') + 1)),
+	}
+}
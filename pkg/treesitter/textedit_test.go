@@ -0,0 +1,77 @@
+package treesitter_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+func TestApplyChange(t *testing.T) {
+	tests := map[string]struct {
+		content  string
+		changes  []lsp.TextDocumentContentChangeEvent
+		expected string
+	}{
+		"insert on a line": {
+			content: "<?php\n$foo = 1;\n",
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Range: &lsp.Range{Start: lsp.Position{Line: 1, Character: 4}, End: lsp.Position{Line: 1, Character: 4}}, Text: "bar"},
+			},
+			expected: "<?php\n$foobar = 1;\n",
+		},
+		"replace across lines": {
+			content: "<?php\nfunction foo() {\n}\n",
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Range: &lsp.Range{Start: lsp.Position{Line: 1, Character: 15}, End: lsp.Position{Line: 2, Character: 1}}, Text: "{\n\treturn 1;\n}"},
+			},
+			expected: "<?php\nfunction foo() {\n\treturn 1;\n}\n",
+		},
+		"changes are applied in order": {
+			content: "<?php\nclass Foo {}\n",
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Range: &lsp.Range{Start: lsp.Position{Line: 1, Character: 6}, End: lsp.Position{Line: 1, Character: 9}}, Text: "Bar"},
+				{Range: &lsp.Range{Start: lsp.Position{Line: 2, Character: 0}, End: lsp.Position{Line: 2, Character: 0}}, Text: "class Baz {}\n"},
+			},
+			expected: "<?php\nclass Bar {}\nclass Baz {}\n",
+		},
+		"delete a line": {
+			content: "<?php\n$a = 1;\n$b = 2;\n",
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Range: &lsp.Range{Start: lsp.Position{Line: 1, Character: 0}, End: lsp.Position{Line: 2, Character: 0}}, Text: ""},
+			},
+			expected: "<?php\n$b = 2;\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			content := tt.content
+			tree, err := treesitter.ParseDocument(content)
+			if err != nil {
+				t.Fatalf("Error parsing document: %s", err)
+			}
+
+			for _, change := range tt.changes {
+				var edit sitter.EditInput
+				content, edit = treesitter.ApplyChange(content, change, lsp.PositionEncodingUTF16)
+				tree.Edit(edit)
+			}
+
+			if content != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, content)
+			}
+
+			incremental, err := treesitter.ParseDocumentIncremental(tree, content)
+			if err != nil {
+				t.Fatalf("Error reparsing document: %s", err)
+			}
+
+			full, _ := treesitter.ParseDocument(content)
+			if incremental.RootNode().String() != full.RootNode().String() {
+				t.Errorf("Expected incremental tree %s, got %s", full.RootNode().String(), incremental.RootNode().String())
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package workspace
+
+import (
+	"ahmedash95/php-lsp-server/pkg/fileuri"
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/symboltable"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"os"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Get returns the document of uri as the editor sees it, the open buffer if
+// there is one and the summary of the indexed file otherwise. Summaries have
+// no content, Document loads it.
+func (s *Workspace) Get(uri string) *treesitter.TextDocumentItem {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if item, ok := s.Overlays[uri]; ok {
+		return item
+	}
+
+	return s.Uris[uri]
+}
+
+// extracted are the symbols of a file along with its declarations, the
+// same symbols for library files.
+type extracted struct {
+	symbols      []treesitter.Symbol
+	declarations []treesitter.Symbol
+}
+
+// diskDocument builds the summary of a file on disk and its global symbols,
+// symbols are extracted from content unless they are given. Summaries only
+// keep the symbols of the file, its content is dropped once their positions
+// are converted. Library files only have their declarations. It also
+// returns the names interned for the file, kept once it is stored.
+func (s *Workspace) diskDocument(uri string, content string, symbols *extracted) (*treesitter.TextDocumentItem, []symboltable.Symbol, []string) {
+	if symbols == nil {
+		all, declarations := treesitter.Extract(content, indexMode(s.FolderOf(uri), fileuri.ToPath(uri)))
+		symbols = &extracted{symbols: all, declarations: declarations}
+	}
+	names := append(s.names.symbols(symbols.symbols), s.names.symbols(symbols.declarations)...)
+
+	lines := treesitter.NewLineIndex(content)
+	item := &treesitter.TextDocumentItem{
+		Uri:        uri,
+		LanguageId: "php",
+		Version:    1,
+		Lines:      lines,
+	}
+	s.setDocumentSymbols(item, symbols.symbols)
+	item.Lines = nil
+
+	return item, symboltable.FromDeclarations(uri, symbols.declarations, s.rangeOf(lines)), names
+}
+
+// Document returns the document of uri with its content and syntax tree,
+// the open buffer if there is one. Indexed files are read again from disk
+// and kept loaded while the memory budget allows it. It returns nil when
+// uri is neither open nor indexed.
+func (s *Workspace) Document(uri string) *treesitter.TextDocumentItem {
+	s.mu.RLock()
+	overlay, open := s.Overlays[uri]
+	summary, indexed := s.Uris[uri]
+	s.mu.RUnlock()
+
+	if open {
+		return overlay
+	}
+	if !indexed {
+		return nil
+	}
+
+	if item := s.loaded.get(summary); item != nil {
+		return item
+	}
+
+	content, err := os.ReadFile(fileuri.ToPath(uri))
+	if err != nil {
+		s.Log.Warnf("Error reading indexed document %s: %s", uri, err)
+		return nil
+	}
+
+	tree, err := treesitter.ParseDocument(string(content))
+	if err != nil {
+		s.Log.Errorf("Error parsing document %s: %s", uri, err)
+	}
+
+	item := *summary
+	item.Text = string(content)
+	item.Tree = tree
+	item.Lines = treesitter.NewLineIndex(item.Text)
+	s.loaded.add(summary, &item, int64(s.Config.Memory.Budget)<<20)
+
+	return &item
+}
+
+// indexMode tells how much of the file at path is indexed, only the
+// declarations of the vendor and library files of its folder.
+func indexMode(folder *Folder, path string) treesitter.Mode {
+	if folder == nil {
+		return treesitter.ModeFull
+	}
+
+	if autoload := folder.Autoload(); autoload != nil && autoload.IsVendor(path) {
+		return treesitter.ModeDeclarations
+	}
+
+	for _, library := range folder.libraries() {
+		if within(library, path) {
+			return treesitter.ModeDeclarations
+		}
+	}
+
+	return treesitter.ModeFull
+}
+
+// Put stores the disk content of a file in the index.
+func (s *Workspace) Put(uri string, content string) {
+	s.put(uri, content, nil)
+}
+
+func (s *Workspace) put(uri string, content string, symbols *extracted) {
+	item, globals, names := s.diskDocument(uri, content, symbols)
+
+	s.mu.Lock()
+	s.Uris[uri] = item
+	s.Symbols.Update(uri, globals)
+	s.names.keep(uri, names)
+	s.mu.Unlock()
+}
+
+// add stores the disk content of a file found by the index, unless the file
+// was stored meanwhile. A save that happened while the file was being read
+// must not be overwritten with the older content.
+func (s *Workspace) add(uri string, content string, symbols *extracted) {
+	item, globals, names := s.diskDocument(uri, content, symbols)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Uris[uri]; ok {
+		s.names.release(names)
+		return
+	}
+
+	s.Uris[uri] = item
+	s.Symbols.Update(uri, globals)
+	s.names.keep(uri, names)
+}
+
+// remove drops the disk content of uri from the index, and of the files
+// below it when it is a directory. Open documents are kept.
+func (s *Workspace) remove(uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := strings.TrimSuffix(uri, "/") + "/"
+	for indexed := range s.Uris {
+		if indexed == uri || strings.HasPrefix(indexed, dir) {
+			delete(s.Uris, indexed)
+			s.Symbols.Remove(indexed)
+			s.loaded.forget(indexed)
+			s.names.forget(indexed)
+		}
+	}
+}
+
+// indexed tells whether the disk content of uri is in the index.
+func (s *Workspace) indexed(uri string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.Uris[uri]
+	return ok
+}
+
+// Open stores a document opened in the editor as an overlay over its disk
+// content. Unlike indexed files, open documents keep their syntax tree and
+// outline so changes are reparsed and walked incrementally.
+func (s *Workspace) Open(uri string, version int, content string) {
+	tree, err := treesitter.ParseDocument(content)
+	if err != nil {
+		s.Log.Errorf("Error parsing document %s: %s", uri, err)
+	}
+
+	item := &treesitter.TextDocumentItem{
+		Uri:        uri,
+		LanguageId: "php",
+		Version:    version,
+		Text:       content,
+		Tree:       tree,
+		Lines:      treesitter.NewLineIndex(content),
+	}
+	s.outline(item, nil)
+	globals := s.openSymbols(item)
+
+	s.mu.Lock()
+	s.Overlays[uri] = item
+	s.Symbols.Open(uri, globals)
+	s.mu.Unlock()
+}
+
+// outline extracts the symbols of an open document, again from the outline
+// of its previous version where edits did not touch it.
+func (s *Workspace) outline(item *treesitter.TextDocumentItem, edits []sitter.EditInput) {
+	switch {
+	case item.Tree == nil:
+		item.Outline = nil
+		item.Changed = nil
+		s.FetchDocumentSymbols(item)
+		return
+	case item.Outline == nil || edits == nil:
+		item.Outline = treesitter.NewOutline(item.Text, item.Tree)
+	default:
+		item.Outline = item.Outline.Update(item.Text, item.Tree, edits)
+	}
+
+	item.Changed = item.Outline.Changed()
+	s.setDocumentSymbols(item, item.Outline.Symbols())
+}
+
+// openSymbols returns the global symbols of an open document, before it is
+// stored as its tree is then shared. They are the declarations of its
+// outline, extracted again only where edits changed the document.
+func (s *Workspace) openSymbols(item *treesitter.TextDocumentItem) []symboltable.Symbol {
+	var declarations []treesitter.Symbol
+	switch {
+	case item.Outline != nil:
+		declarations = treesitter.Declarations(item.Outline.Symbols())
+	case item.Tree != nil:
+		declarations = treesitter.GetDeclarationSymbols(item.Text, item.Tree)
+	default:
+		_, declarations = treesitter.Extract(item.Text, treesitter.ModeDeclarations)
+	}
+
+	return symboltable.FromDeclarations(item.Uri, declarations, s.rangeOf(item.Lines))
+}
+
+// Update applies the changes of a didChange notification in order. Changes
+// with a range are applied to the stored text and to a copy of its syntax
+// tree, so the document is reparsed incrementally.
+func (s *Workspace) Update(uri string, version int, contentChanges []lsp.TextDocumentContentChangeEvent) {
+	s.mu.RLock()
+	old := s.Overlays[uri]
+	s.mu.RUnlock()
+
+	if old == nil {
+		s.Log.Warnf("Update for a document that is not open: %s", uri)
+		return
+	}
+
+	if version <= old.Version {
+		s.Log.Warnf("Ignoring out of order change of %s: version %d after %d", uri, version, old.Version)
+		return
+	}
+
+	text := old.Text
+	var tree *sitter.Tree
+	if old.Tree != nil {
+		tree = old.Tree.Copy()
+	}
+
+	// edits are kept while the old tree is, a full change starts over
+	var edits []sitter.EditInput
+	if tree != nil {
+		edits = []sitter.EditInput{}
+	}
+	for _, change := range contentChanges {
+		if change.Range == nil {
+			text = change.Text
+			tree = nil
+			edits = nil
+			continue
+		}
+
+		var edit sitter.EditInput
+		text, edit = treesitter.ApplyChange(text, change, s.PositionEncoding)
+		if tree != nil {
+			tree.Edit(edit)
+			edits = append(edits, edit)
+		}
+	}
+
+	newTree, err := treesitter.ParseDocumentIncremental(tree, text)
+	if err != nil {
+		s.Log.Errorf("Error parsing document %s: %s", uri, err)
+	}
+
+	item := *old
+	item.Version = version
+	item.Text = text
+	item.Tree = newTree
+	item.Lines = treesitter.NewLineIndex(text)
+	s.outline(&item, edits)
+	globals := s.openSymbols(&item)
+
+	s.mu.Lock()
+	s.Overlays[uri] = &item
+	s.Symbols.Open(uri, globals)
+	s.mu.Unlock()
+}
+
+// Close drops the open buffer of uri so the document reverts to its disk
+// content, unsaved changes are discarded. A file outside every folder or
+// left out by the indexing settings is dropped altogether, its symbols are
+// only known while it is open.
+func (s *Workspace) Close(uri string) {
+	s.mu.Lock()
+	delete(s.Overlays, uri)
+	s.Symbols.Close(uri)
+	s.mu.Unlock()
+
+	if !s.indexable(uri) {
+		s.remove(uri)
+		return
+	}
+
+	if s.indexed(uri) {
+		return
+	}
+
+	// the file was opened before the index reached it, or was never saved
+	content, err := os.ReadFile(fileuri.ToPath(uri))
+	if err != nil {
+		logger.Debugf("Closed document %s is not on disk: %s", uri, err)
+		return
+	}
+
+	s.Put(uri, string(content))
+}
+
+// Save refreshes the disk content of uri. text is the saved content when the
+// client sends it along, otherwise the file is read from disk. Files the
+// index leaves out are only known through their open buffer.
+func (s *Workspace) Save(uri string, text *string) {
+	if !s.indexable(uri) {
+		return
+	}
+
+	if text != nil {
+		s.Put(uri, *text)
+		return
+	}
+
+	content, err := os.ReadFile(fileuri.ToPath(uri))
+	if err != nil {
+		s.Log.Errorf("Error reading saved document %s: %s", uri, err)
+		return
+	}
+
+	s.Put(uri, string(content))
+}
+
+// indexable tells whether the file at uri belongs in the index: it is in a
+// folder whose scanner includes it.
+func (s *Workspace) indexable(uri string) bool {
+	folder := s.FolderOf(uri)
+	if folder == nil {
+		return false
+	}
+
+	return folder.scanner().Includes(fileuri.ToPath(uri), []string{".php"})
+}
@@ -0,0 +1,265 @@
+package workspace
+
+import (
+	"ahmedash95/php-lsp-server/pkg/composer"
+	"ahmedash95/php-lsp-server/pkg/config"
+	"ahmedash95/php-lsp-server/pkg/fileuri"
+	"ahmedash95/php-lsp-server/pkg/indexcache"
+	"ahmedash95/php-lsp-server/pkg/logger"
+	workspacescanner "ahmedash95/php-lsp-server/pkg/workspace_scanner"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Folder is a root of the workspace. Each folder has its own settings, cache
+// and composer project, a file belongs to the innermost folder holding it.
+//
+// A folder is never changed once added, except for its composer project,
+// changing its settings replaces it.
+type Folder struct {
+	Name string
+	Path string
+	// Config holds the settings of the client for this folder.
+	Config config.Config
+	// Cache keeps the symbols of the files of the folder between runs, nil
+	// when caching is disabled.
+	Cache *indexcache.Cache
+
+	// ctx is cancelled once the folder is removed, its background work
+	// stops with it.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// log is the logger of the workspace.
+	log *logger.Logger
+
+	// mu guards autoload, the composer project of the folder, nil when the
+	// folder does not use composer.
+	mu       sync.RWMutex
+	autoload *composer.Project
+}
+
+// AddFolder adds a root to the workspace, or replaces the one at the same
+// path to change its settings. The cache of the folder is opened when its
+// settings enable it.
+func (s *Workspace) AddFolder(name string, path string, cfg config.Config) *Folder {
+	path = filepath.Clean(path)
+	folder := &Folder{
+		Name:   name,
+		Path:   path,
+		Config: cfg,
+		log:    s.Log,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var old *Folder
+	for i, f := range s.folders {
+		if f.Path == path {
+			old = f
+			s.folders[i] = folder
+			break
+		}
+	}
+
+	if old != nil {
+		folder.ctx, folder.cancel = old.ctx, old.cancel
+		folder.autoload = old.Autoload()
+		if cfg.Cache == old.Config.Cache {
+			folder.Cache = old.Cache
+		}
+	} else {
+		folder.ctx, folder.cancel = context.WithCancel(context.Background())
+		s.folders = append(s.folders, folder)
+	}
+
+	if cfg.Cache.Enabled && folder.Cache == nil {
+		directory := cfg.Cache.Directory
+		if directory == "" {
+			directory = indexcache.DefaultDir()
+		}
+
+		cache, err := indexcache.Open(directory, path)
+		if err != nil {
+			s.Log.Warnf("Indexing %s without cache: %s", path, err)
+		}
+		folder.Cache = cache
+	}
+
+	return folder
+}
+
+// RemoveFolder removes the root at path from the workspace, its files leave
+// the index unless another folder holds them. Open documents are kept.
+func (s *Workspace) RemoveFolder(path string) {
+	path = filepath.Clean(path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed *Folder
+	for i, f := range s.folders {
+		if f.Path == path {
+			removed = f
+			s.folders = append(s.folders[:i:i], s.folders[i+1:]...)
+			break
+		}
+	}
+
+	if removed == nil {
+		return
+	}
+	removed.cancel()
+
+	for uri := range s.Uris {
+		path := fileuri.ToPath(uri)
+		if removed.holds(path) && s.folderOf(path) == nil {
+			delete(s.Uris, uri)
+			s.Symbols.Remove(uri)
+			s.loaded.forget(uri)
+			s.names.forget(uri)
+		}
+	}
+}
+
+// Folders returns the roots of the workspace.
+func (s *Workspace) Folders() []*Folder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]*Folder(nil), s.folders...)
+}
+
+// FolderOf returns the folder the file at uri belongs to, nil when it is
+// outside the workspace.
+func (s *Workspace) FolderOf(uri string) *Folder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.folderOf(fileuri.ToPath(uri))
+}
+
+// folderOf finds the innermost folder holding path, then a folder including
+// it as a library from outside its root. s.mu must be held.
+func (s *Workspace) folderOf(path string) *Folder {
+	var found *Folder
+	for _, folder := range s.folders {
+		if within(folder.Path, path) && (found == nil || len(folder.Path) > len(found.Path)) {
+			found = folder
+		}
+	}
+
+	if found != nil {
+		return found
+	}
+
+	for _, folder := range s.folders {
+		if folder.holds(path) {
+			return folder
+		}
+	}
+
+	return nil
+}
+
+// holds tells whether path is in the folder or in one of its libraries.
+func (f *Folder) holds(path string) bool {
+	if within(f.Path, path) {
+		return true
+	}
+
+	for _, library := range f.libraries() {
+		if within(library, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// libraries returns the absolute paths of the directories of the folder
+// whose files only have their declarations indexed, the vendor directory
+// first.
+func (f *Folder) libraries() []string {
+	vendor := filepath.Join(f.Path, "vendor")
+	if autoload := f.Autoload(); autoload != nil {
+		vendor = autoload.VendorDir
+	}
+
+	libraries := []string{vendor}
+	for _, library := range f.Config.Indexing.LibraryPaths {
+		if !filepath.IsAbs(library) {
+			library = filepath.Join(f.Path, library)
+		}
+		libraries = append(libraries, library)
+	}
+
+	return libraries
+}
+
+// scanner lists the files to index following the indexing settings. The
+// libraries are included even when ignored, the vendor directory always is.
+func (f *Folder) scanner() *workspacescanner.Scanner {
+	scanner := workspacescanner.NewScanner(f.Path)
+	scanner.Exclude = f.Config.Indexing.Exclude
+	scanner.MaxFileSize = f.Config.Indexing.MaxFileSize
+	scanner.Gitignore = f.Config.Indexing.Gitignore
+	scanner.Include = append(f.libraries(), f.Config.Indexing.Include...)
+	scanner.Log = f.log
+
+	return scanner
+}
+
+// sources lists the files of the project like scanner, without those of
+// its libraries.
+func (f *Folder) sources() *workspacescanner.Scanner {
+	scanner := f.scanner()
+	scanner.Include = f.Config.Indexing.Include
+	scanner.Exclude = append([]string(nil), scanner.Exclude...)
+	for _, library := range f.libraries() {
+		if relative, err := filepath.Rel(f.Path, library); err == nil && relative != "." && within(f.Path, library) {
+			scanner.Exclude = append(scanner.Exclude, "/"+filepath.ToSlash(relative))
+		}
+	}
+
+	return scanner
+}
+
+// loadComposer reads the autoload configuration of the folder. A deleted
+// composer.json drops it, a broken one keeps the last one read.
+func (f *Folder) loadComposer() {
+	project, err := composer.Load(f.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		f.log.Warnf("Error reading composer.json of %s: %s", f.Path, err)
+		return
+	}
+
+	f.mu.Lock()
+	f.autoload = project
+	f.mu.Unlock()
+}
+
+// Autoload returns the composer autoload configuration of the folder, nil
+// when it does not use composer.
+func (f *Folder) Autoload() *composer.Project {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.autoload
+}
+
+// removed tells whether the folder left the workspace.
+func (f *Folder) removed() bool {
+	return f.ctx.Err() != nil
+}
+
+// within tells whether path is dir or inside it.
+func within(dir string, path string) bool {
+	relative, err := filepath.Rel(dir, path)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,108 @@
+package workspace_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/config"
+	"ahmedash95/php-lsp-server/pkg/workspace"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestFolderOf(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Cache.Enabled = false
+
+	w := workspace.NewWorkspace("")
+	w.AddFolder("app", filepath.Join(dir, "app"), cfg)
+	w.AddFolder("package", filepath.Join(dir, "app", "packages", "package"), cfg)
+	shared := cfg
+	shared.Indexing.LibraryPaths = []string{"../shared"}
+	w.AddFolder("other", filepath.Join(dir, "other"), shared)
+
+	tests := map[string]string{
+		"app/a.php":                  "app",
+		"app/packages/package/b.php": "package",
+		"app/packages/other/c.php":   "app",
+		"shared/d.php":               "other",
+		"outside/e.php":              "",
+	}
+
+	for file, expected := range tests {
+		t.Run(file, func(t *testing.T) {
+			name := ""
+			if folder := w.FolderOf("file://" + filepath.Join(dir, file)); folder != nil {
+				name = folder.Name
+			}
+
+			if name != expected {
+				t.Errorf("Expected %q, got %q", expected, name)
+			}
+		})
+	}
+}
+
+func TestFoldersHaveTheirOwnSettings(t *testing.T) {
+	dir := t.TempDir()
+	code := "<?php\nfunction helper() {\n    $local = 1;\n}"
+	for _, file := range []string{"a/stubs/a.php", "b/stubs/b.php"} {
+		writeFile(t, filepath.Join(dir, file), code)
+	}
+
+	cfg := config.Default()
+	cfg.Cache.Enabled = false
+	stubs := cfg
+	stubs.Indexing.LibraryPaths = []string{"stubs"}
+
+	w := workspace.NewWorkspace("")
+	w.AddFolder("a", filepath.Join(dir, "a"), stubs)
+	w.AddFolder("b", filepath.Join(dir, "b"), cfg)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	// the local variable is only indexed outside of library paths
+	tests := map[string]int{
+		"a/stubs/a.php": 0,
+		"b/stubs/b.php": 1,
+	}
+
+	for file, children := range tests {
+		t.Run(file, func(t *testing.T) {
+			doc := w.Get("file://" + filepath.Join(dir, file))
+			if doc == nil {
+				t.Fatalf("Expected %s to be indexed", file)
+			}
+
+			if len(doc.DocumentSymbols) != 1 || len(doc.DocumentSymbols[0].Children) != children {
+				t.Errorf("Expected helper with %d children, got %v", children, doc.DocumentSymbols)
+			}
+		})
+	}
+}
+
+func TestRemoveFolderKeepsFilesOfOtherFolders(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app/a.php"), "<?php\nclass A {}")
+	writeFile(t, filepath.Join(dir, "app/package/b.php"), "<?php\nclass B {}")
+
+	cfg := config.Default()
+	cfg.Cache.Enabled = false
+
+	w := workspace.NewWorkspace("")
+	w.AddFolder("app", filepath.Join(dir, "app"), cfg)
+	w.AddFolder("package", filepath.Join(dir, "app/package"), cfg)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	w.RemoveFolder(filepath.Join(dir, "app"))
+
+	if len(w.Folders()) != 1 {
+		t.Errorf("Expected 1 folder left, got %d", len(w.Folders()))
+	}
+
+	if w.Get("file://"+filepath.Join(dir, "app/a.php")) != nil {
+		t.Errorf("Expected the files of the removed folder to be dropped")
+	}
+
+	if w.Get("file://"+filepath.Join(dir, "app/package/b.php")) == nil {
+		t.Errorf("Expected the files of the remaining folder to be kept")
+	}
+}
@@ -0,0 +1,118 @@
+package workspace
+
+import (
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"sync"
+)
+
+// interner shares a single copy of the names repeated across files, like
+// those of common methods. Names extracted from a document are slices of
+// its content, a copy also lets the content be collected.
+//
+// Only the names of declarations and of their members are interned, those
+// of variables are rarely shared and only copied. Each file holds a
+// reference to the names it interned until it leaves the index, so the
+// table only keeps the names of indexed files.
+type interner struct {
+	mu      sync.Mutex
+	strings map[string]string
+	refs    map[string]int
+	// files holds the names interned for each indexed file.
+	files map[string][]string
+}
+
+func newInterner() *interner {
+	return &interner{
+		strings: make(map[string]string),
+		refs:    make(map[string]int),
+		files:   make(map[string][]string),
+	}
+}
+
+// intern returns the shared copy of s, taking a reference to it. i.mu must
+// be held.
+func (i *interner) intern(s string) string {
+	interned, ok := i.strings[s]
+	if !ok {
+		// a copy no longer refers to the content the name was sliced from
+		interned = string([]byte(s))
+		i.strings[interned] = interned
+	}
+	i.refs[interned]++
+
+	return interned
+}
+
+// symbols interns the names of symbols and of their children in place and
+// returns the names it took a reference to, until they are kept for a file
+// or released.
+func (i *interner) symbols(symbols []treesitter.Symbol) []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var names []string
+	i.walk(symbols, &names)
+
+	return names
+}
+
+func (i *interner) walk(symbols []treesitter.Symbol, names *[]string) {
+	for j := range symbols {
+		symbol := &symbols[j]
+		if symbol.Kind == treesitter.Kind_Variable {
+			symbol.Name = string([]byte(symbol.Name))
+		} else {
+			symbol.Name = i.intern(symbol.Name)
+			*names = append(*names, symbol.Name)
+		}
+
+		if symbol.FQN != "" {
+			symbol.FQN = i.intern(symbol.FQN)
+			*names = append(*names, symbol.FQN)
+		}
+
+		i.walk(symbol.Children, names)
+	}
+}
+
+// keep records names as those of the file at uri, releasing the names it
+// held before.
+func (i *interner) keep(uri string, names []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.drop(i.files[uri])
+	if len(names) == 0 {
+		delete(i.files, uri)
+		return
+	}
+	i.files[uri] = names
+}
+
+// forget releases the names of the file at uri once it left the index.
+func (i *interner) forget(uri string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.drop(i.files[uri])
+	delete(i.files, uri)
+}
+
+// release gives back names interned for a file that was not stored.
+func (i *interner) release(names []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.drop(names)
+}
+
+// drop releases a reference to each of names, a name nothing refers to
+// leaves the table. i.mu must be held.
+func (i *interner) drop(names []string) {
+	for _, name := range names {
+		if i.refs[name]--; i.refs[name] <= 0 {
+			delete(i.refs, name)
+			delete(i.strings, name)
+		}
+	}
+}
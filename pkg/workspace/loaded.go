@@ -0,0 +1,91 @@
+package workspace
+
+import (
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	"container/list"
+	"sync"
+)
+
+// treeCost is how many times the size of its content a document loaded
+// from disk is counted for, its line index and syntax tree included.
+const treeCost = 6
+
+// loadedDocuments keeps the indexed files read back from disk for requests,
+// within a memory budget. The least recently used are dropped first.
+type loadedDocuments struct {
+	mu    sync.Mutex
+	size  int64
+	order *list.List
+	items map[string]*list.Element
+}
+
+type loadedDocument struct {
+	// summary is the indexed item the document was loaded for, it is stale
+	// once the file is indexed again.
+	summary *treesitter.TextDocumentItem
+	item    *treesitter.TextDocumentItem
+	size    int64
+}
+
+func newLoadedDocuments() *loadedDocuments {
+	return &loadedDocuments{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns the document loaded for summary, nil when there is none.
+func (l *loadedDocuments) get(summary *treesitter.TextDocumentItem) *treesitter.TextDocumentItem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, ok := l.items[summary.Uri]
+	if !ok {
+		return nil
+	}
+
+	loaded := element.Value.(*loadedDocument)
+	if loaded.summary != summary {
+		l.drop(element)
+		return nil
+	}
+
+	l.order.MoveToFront(element)
+	return loaded.item
+}
+
+// add keeps item loaded for summary and drops the least recently used
+// documents over budget bytes. A document bigger than the budget is not kept.
+func (l *loadedDocuments) add(summary *treesitter.TextDocumentItem, item *treesitter.TextDocumentItem, budget int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if element, ok := l.items[summary.Uri]; ok {
+		l.drop(element)
+	}
+
+	size := int64(len(item.Text)) * treeCost
+	if size > budget {
+		return
+	}
+
+	l.items[summary.Uri] = l.order.PushFront(&loadedDocument{summary: summary, item: item, size: size})
+	l.size += size
+
+	for l.size > budget {
+		l.drop(l.order.Back())
+	}
+}
+
+// forget drops the document loaded for uri.
+func (l *loadedDocuments) forget(uri string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if element, ok := l.items[uri]; ok {
+		l.drop(element)
+	}
+}
+
+func (l *loadedDocuments) drop(element *list.Element) {
+	loaded := l.order.Remove(element).(*loadedDocument)
+	delete(l.items, loaded.summary.Uri)
+	l.size -= loaded.size
+}
@@ -0,0 +1,212 @@
+package workspace
+
+import (
+	"ahmedash95/php-lsp-server/pkg/fileuri"
+	"ahmedash95/php-lsp-server/pkg/logger"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/treesitter"
+	workspacescanner "ahmedash95/php-lsp-server/pkg/workspace_scanner"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WatchedFiles are the glob patterns of the files the index depends on.
+var WatchedFiles = []string{"**/*.php", "**/composer.json", "**/composer.lock"}
+
+// FilesChanged updates the index with files changed outside the editor. The
+// disk is the source of truth, an event only tells which file to look at, so
+// events handled out of order still leave the index right.
+func (s *Workspace) FilesChanged(changes []lsp.FileEvent) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	// the autoload configuration decides how much of the other files is
+	// indexed, it is reloaded first
+	reloaded := make(map[*Folder]bool)
+	var removed []lsp.FileEvent
+	for _, change := range changes {
+		path := fileuri.ToPath(change.Uri)
+		if name := filepath.Base(path); name != "composer.json" && name != "composer.lock" {
+			continue
+		}
+
+		if folder := s.FolderOf(change.Uri); folder != nil && !reloaded[folder] && filepath.Dir(path) == folder.Path {
+			logger.Infof("Reloading composer autoload configuration of %s", folder.Path)
+			modes := s.indexedModes(folder)
+			folder.loadComposer()
+			reloaded[folder] = true
+
+			// files moved in or out of the vendor directory are indexed
+			// again in their new mode
+			for uri, mode := range modes {
+				if indexMode(folder, fileuri.ToPath(uri)) != mode {
+					removed = append(removed, lsp.FileEvent{Uri: uri, Type: lsp.FileChangeChanged})
+				}
+			}
+		}
+	}
+	changes = append(changes[:len(changes):len(changes)], removed...)
+
+	scanners := make(map[*Folder]*workspacescanner.Scanner)
+	flush := make(map[*Folder]bool)
+	remove := func(folder *Folder, uri string, file string) {
+		logger.Debugf("Removing file: %s", uri)
+		s.remove(uri)
+		if folder != nil && folder.Cache != nil {
+			folder.Cache.Forget(file)
+			flush[folder] = true
+		}
+	}
+
+	for _, change := range changes {
+		path := fileuri.ToPath(change.Uri)
+		uri := fileuri.FromPath(path)
+
+		folder := s.FolderOf(uri)
+		file := path
+		if folder != nil {
+			if relative, err := filepath.Rel(folder.Path, path); err == nil {
+				file = relative
+			}
+		}
+
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			remove(folder, uri, file)
+			continue
+		}
+
+		if err != nil || info.IsDir() || folder == nil {
+			continue
+		}
+
+		scanner, ok := scanners[folder]
+		if !ok {
+			scanner = folder.scanner()
+			scanners[folder] = scanner
+		}
+		if !scanner.Includes(path, []string{".php"}) {
+			// a file excluded since it was indexed leaves the index too
+			if s.indexed(uri) {
+				remove(folder, uri, file)
+			}
+			continue
+		}
+
+		logger.Debugf("Reindexing file: %s", uri)
+		content, symbols, err := s.readFile(folder, path, file)
+		if err != nil {
+			s.Log.Warnf("Error reading file: %s", err)
+			continue
+		}
+		s.put(uri, content, symbols)
+		flush[folder] = folder.Cache != nil
+	}
+
+	for folder, ok := range flush {
+		if !ok {
+			continue
+		}
+
+		if err := folder.Cache.Flush(); err != nil {
+			s.Log.Warnf("Error writing index cache: %s", err)
+		}
+	}
+}
+
+// indexedModes returns the mode each indexed file of folder is indexed in.
+func (s *Workspace) indexedModes(folder *Folder) map[string]treesitter.Mode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	modes := make(map[string]treesitter.Mode)
+	for uri := range s.Uris {
+		path := fileuri.ToPath(uri)
+		if s.folderOf(path) == folder {
+			modes[uri] = indexMode(folder, path)
+		}
+	}
+
+	return modes
+}
+
+// fileState is what polling compares to notice a change.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Poll looks for changed files of folder every interval until ctx is done or
+// the folder is removed, for clients that cannot watch files themselves.
+// Only the sources of the project are looked at, the vendor and library
+// files change along with composer.json and composer.lock.
+func (s *Workspace) Poll(ctx context.Context, folder *Folder, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := snapshot(ctx, folder)
+	for {
+		select {
+		case <-ticker.C:
+			current := snapshot(ctx, folder)
+			if ctx.Err() != nil {
+				// a partial snapshot would report files as deleted
+				return
+			}
+			if changes := diffSnapshots(previous, current); len(changes) > 0 {
+				s.FilesChanged(changes)
+			}
+			previous = current
+		case <-ctx.Done():
+			return
+		case <-folder.ctx.Done():
+			return
+		}
+	}
+}
+
+// snapshot records the state of the files of folder the index depends on,
+// those found before ctx is done.
+func snapshot(ctx context.Context, folder *Folder) map[string]fileState {
+	paths := []string{
+		filepath.Join(folder.Path, "composer.json"),
+		filepath.Join(folder.Path, "composer.lock"),
+	}
+	for _, file := range folder.sources().Scan(ctx, []string{".php"}) {
+		paths = append(paths, filepath.Join(folder.Path, file))
+	}
+
+	states := make(map[string]fileState, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			states[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+
+	return states
+}
+
+func diffSnapshots(previous map[string]fileState, current map[string]fileState) []lsp.FileEvent {
+	var changes []lsp.FileEvent
+	for path, state := range current {
+		old, ok := previous[path]
+		switch {
+		case !ok:
+			changes = append(changes, lsp.FileEvent{Uri: fileuri.FromPath(path), Type: lsp.FileChangeCreated})
+		case old != state:
+			changes = append(changes, lsp.FileEvent{Uri: fileuri.FromPath(path), Type: lsp.FileChangeChanged})
+		}
+	}
+
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			changes = append(changes, lsp.FileEvent{Uri: fileuri.FromPath(path), Type: lsp.FileChangeDeleted})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,166 @@
+package workspace_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/config"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/workspace"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+}
+
+func symbolName(w *workspace.Workspace, uri string) string {
+	doc := w.Get(uri)
+	if doc == nil {
+		return ""
+	}
+	if len(doc.DocumentSymbols) == 0 {
+		return "-"
+	}
+
+	return doc.DocumentSymbols[0].Name
+}
+
+func TestFilesChanged(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "changed.php"), "<?php\nclass Before {}")
+	writeFile(t, filepath.Join(root, "deleted.php"), "<?php\nclass Deleted {}")
+	writeFile(t, filepath.Join(root, "dir/nested.php"), "<?php\nclass Nested {}")
+	writeFile(t, filepath.Join(root, "big.php"), "<?php\nclass Big {}")
+
+	w := workspace.NewWorkspace(root)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	writeFile(t, filepath.Join(root, "changed.php"), "<?php\nclass After {}")
+	writeFile(t, filepath.Join(root, "created.php"), "<?php\nclass Created {}")
+	writeFile(t, filepath.Join(root, "node_modules/excluded.php"), "<?php\nclass Excluded {}")
+	writeFile(t, filepath.Join(root, "composer.json"), `{"autoload":{"psr-4":{"App\\":"app/"}}}`)
+	writeFile(t, filepath.Join(root, "big.php"), "<?php\nclass Big {}\n"+strings.Repeat(" ", 3<<20))
+	os.Remove(filepath.Join(root, "deleted.php"))
+	os.RemoveAll(filepath.Join(root, "dir"))
+
+	uri := func(file string) string { return "file://" + root + "/" + file }
+	w.FilesChanged([]lsp.FileEvent{
+		{Uri: uri("changed.php"), Type: lsp.FileChangeChanged},
+		{Uri: uri("created.php"), Type: lsp.FileChangeCreated},
+		{Uri: uri("node_modules/excluded.php"), Type: lsp.FileChangeCreated},
+		{Uri: uri("composer.json"), Type: lsp.FileChangeCreated},
+		// a deletion reported as a change is still a deletion
+		{Uri: uri("deleted.php"), Type: lsp.FileChangeChanged},
+		{Uri: uri("dir"), Type: lsp.FileChangeDeleted},
+		// bigger than the default limit by now
+		{Uri: uri("big.php"), Type: lsp.FileChangeChanged},
+	})
+
+	tests := map[string]string{
+		"changed.php":               "After",
+		"created.php":               "Created",
+		"node_modules/excluded.php": "",
+		"deleted.php":               "",
+		"dir/nested.php":            "",
+		"big.php":                   "",
+	}
+
+	for file, expected := range tests {
+		t.Run(file, func(t *testing.T) {
+			if name := symbolName(w, uri(file)); name != expected {
+				t.Errorf("Expected %q, got %q", expected, name)
+			}
+		})
+	}
+
+	if w.Folders()[0].Autoload() == nil {
+		t.Errorf("Expected the composer autoload configuration to be loaded")
+	}
+
+	os.Remove(filepath.Join(root, "composer.json"))
+	w.FilesChanged([]lsp.FileEvent{{Uri: uri("composer.json"), Type: lsp.FileChangeDeleted}})
+	if w.Folders()[0].Autoload() != nil {
+		t.Errorf("Expected the composer autoload configuration to be dropped with composer.json")
+	}
+}
+
+func TestPollFindsChangedFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.php"), "<?php\nclass A {}")
+
+	w := workspace.NewWorkspace(root)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Poll(ctx, w.Folders()[0], 10*time.Millisecond)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// let the poller record the files before changing them
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, filepath.Join(root, "b.php"), "<?php\nclass B {}")
+	writeFile(t, filepath.Join(root, "vendor/acme/V.php"), "<?php\nclass V {}")
+	os.Remove(filepath.Join(root, "a.php"))
+
+	uri := func(file string) string { return "file://" + root + "/" + file }
+	deadline := time.Now().Add(5 * time.Second)
+	for symbolName(w, uri("b.php")) != "B" || symbolName(w, uri("a.php")) != "" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected b.php to be indexed and a.php removed, got %q and %q", symbolName(w, uri("b.php")), symbolName(w, uri("a.php")))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if name := symbolName(w, uri("vendor/acme/V.php")); name != "" {
+		t.Errorf("Expected vendor files not to be polled, got %q", name)
+	}
+}
+
+func TestComposerChangesIndexFilesInTheirNewMode(t *testing.T) {
+	root := t.TempDir()
+	code := "<?php\nfunction helper() {\n    $local = 1;\n}"
+	writeFile(t, filepath.Join(root, "lib/acme/a.php"), code)
+	writeFile(t, filepath.Join(root, "vendor/acme/a.php"), code)
+
+	w := workspace.NewWorkspace("")
+	cfg := config.Default()
+	cfg.Cache.Enabled = false
+	w.AddFolder("root", root, cfg)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	writeFile(t, filepath.Join(root, "composer.json"), `{"config":{"vendor-dir":"lib"}}`)
+	uri := func(file string) string { return "file://" + root + "/" + file }
+	w.FilesChanged([]lsp.FileEvent{{Uri: uri("composer.json"), Type: lsp.FileChangeCreated}})
+
+	tests := map[string]int{
+		"lib/acme/a.php":    0,
+		"vendor/acme/a.php": 1,
+	}
+
+	for file, locals := range tests {
+		t.Run(file, func(t *testing.T) {
+			doc := w.Get(uri(file))
+			if doc == nil || len(doc.DocumentSymbols) != 1 {
+				t.Fatalf("Expected %s to be indexed", file)
+			}
+
+			if got := len(doc.DocumentSymbols[0].Children); got != locals {
+				t.Errorf("Expected %d local symbols, got %d", locals, got)
+			}
+		})
+	}
+}
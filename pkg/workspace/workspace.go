@@ -3,177 +3,502 @@ package workspace
 import (
 	"ahmedash95/php-lsp-server/internal/util"
 	"ahmedash95/php-lsp-server/pkg/completor"
+	"ahmedash95/php-lsp-server/pkg/config"
+	"ahmedash95/php-lsp-server/pkg/fileuri"
 	"ahmedash95/php-lsp-server/pkg/logger"
 	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/symboltable"
 	"ahmedash95/php-lsp-server/pkg/treesitter"
-	workspacescanner "ahmedash95/php-lsp-server/pkg/workspace_scanner"
-	"fmt"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/sahilm/fuzzy"
+	sitter "github.com/smacker/go-tree-sitter"
 )
 
+// Client sends requests and notifications to the editor.
+type Client interface {
+	Call(ctx context.Context, method string, params any, result any) error
+	Notify(method string, params any)
+}
+
 type Workspace struct {
-	Uris     map[string]*treesitter.TextDocumentItem
-	RootPath string
+	// Uris holds the summaries of the indexed files as they are on disk,
+	// their symbols without their content.
+	Uris map[string]*treesitter.TextDocumentItem
+	// Overlays holds the documents open in the editor, they shadow the
+	// content on disk until they are closed.
+	Overlays map[string]*treesitter.TextDocumentItem
+
+	// PositionEncoding is the encoding negotiated with the client for the
+	// character offsets of positions.
+	PositionEncoding string
+	// Capabilities of the client, responses only use what it supports.
+	Capabilities lsp.ClientCapabilities
+	// Client talks back to the editor, nil when there is none.
+	Client Client
+	// Config holds the settings of the client, folders start from them.
+	Config config.Config
+	// Symbols indexes the classes, functions and constants of the
+	// workspace by fully qualified name.
+	Symbols *symboltable.Table
+	// Log receives the warnings and errors of the workspace, those of the
+	// session of its client. Nil logs to the default logger.
+	Log *logger.Logger
+
+	// folders are the roots of the workspace.
+	folders []*Folder
+	// names interns the names of the symbols of indexed files.
+	names *interner
+	// loaded keeps the indexed files read back from disk for requests.
+	loaded *loadedDocuments
+
+	// mu guards Uris, Overlays and folders. Documents stored in them are
+	// never mutated in place, a change replaces the whole item so readers can
+	// keep using the one they already got.
+	mu sync.RWMutex
+	// watchMu serializes the handling of changed files.
+	watchMu sync.Mutex
 }
 
+// NewWorkspace creates a workspace with rootpath as its only folder, or
+// without folders when rootpath is empty.
 func NewWorkspace(rootpath string) *Workspace {
-	return &Workspace{
-		Uris:     make(map[string]*treesitter.TextDocumentItem),
-		RootPath: rootpath,
+	s := &Workspace{
+		Uris:             make(map[string]*treesitter.TextDocumentItem),
+		Overlays:         make(map[string]*treesitter.TextDocumentItem),
+		PositionEncoding: lsp.DefaultPositionEncoding,
+		Config:           config.Default(),
+		Symbols:          symboltable.New(),
+		names:            newInterner(),
+		loaded:           newLoadedDocuments(),
+	}
+
+	if rootpath != "" {
+		cfg := s.Config
+		cfg.Cache.Enabled = false
+		s.AddFolder(filepath.Base(rootpath), rootpath, cfg)
 	}
+
+	return s
+}
+
+// progressInterval is the least time between two progress reports of the
+// index, reporting every file would flood the client.
+var progressInterval = 100 * time.Millisecond
+
+// Progress tells how far the index is.
+type Progress struct {
+	// Folder is the name of the folder of the last indexed file, File its
+	// path relative to the folder.
+	Folder  string
+	File    string
+	Indexed int
+	Total   int
+}
+
+func (p Progress) Percentage() int {
+	return util.CalculatePercentage(p.Indexed, p.Total)
+}
+
+// StartIndex indexes every folder of the workspace.
+func (s *Workspace) StartIndex(ctx context.Context, update func(Progress), end func()) {
+	s.Index(ctx, s.Folders(), update, end)
+}
+
+// indexJob is a file to index and the folder it was found in, files of
+// libraries outside the folder are relative to it too.
+type indexJob struct {
+	folder *Folder
+	file   string
+}
+
+// Index parses the PHP files of folders on a pool of workers and adds them
+// to the index. Requests keep being served while it runs, they see the files
+// indexed so far. Files already indexed are skipped.
+func (s *Workspace) Index(ctx context.Context, folders []*Folder, update func(Progress), end func()) {
+	s.index(ctx, folders, false, update, end)
 }
 
-func (s *Workspace) StartIndex(update func(path string, percent int), end func()) {
-	logger.GetLogger().Printf("Indexing workspace: %s", s.RootPath)
+// Reindex parses the PHP files of folders again, replacing those in the
+// index. Once every file is parsed, the indexed files of folders that are
+// no longer found are dropped.
+func (s *Workspace) Reindex(ctx context.Context, folders []*Folder, update func(Progress), end func()) {
+	s.index(ctx, folders, true, update, end)
+}
+
+func (s *Workspace) index(ctx context.Context, folders []*Folder, replace bool, update func(Progress), end func()) {
+	var jobs []indexJob
+	for _, folder := range folders {
+		logger.Infof("Indexing workspace folder: %s", folder.Path)
 
-	scanner := workspacescanner.NewScanner(s.RootPath)
-	files := scanner.Scan([]string{".php"})
+		folder.loadComposer()
+		for _, file := range folder.scanner().Scan(ctx, []string{".php"}) {
+			jobs = append(jobs, indexJob{folder: folder, file: file})
+		}
+	}
 
 	defer end()
 
-	// @todo parse file in parallel to speed up indexing
-	for i, file := range files {
-		uri := fmt.Sprintf("file://%s/%s", s.RootPath, file)
+	queue := make(chan indexJob)
+	go func() {
+		defer close(queue)
+
+		for _, job := range jobs {
+			select {
+			case queue <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	progress := newProgress(len(jobs), update)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.Config.IndexWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for job := range queue {
+				if ctx.Err() != nil || job.folder.removed() {
+					continue
+				}
+
+				s.indexFile(job.folder, job.file, replace)
+				progress.done(job)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// a stopped run did not see every file, the manifest keeps the entries
+	// of the files it did not reach
+	if ctx.Err() != nil {
+		logger.Infof("Indexing stopped: %s", ctx.Err())
+		return
+	}
+
+	found := make(map[*Folder]map[string]bool, len(folders))
+	for _, job := range jobs {
+		if found[job.folder] == nil {
+			found[job.folder] = make(map[string]bool)
+		}
+		found[job.folder][job.file] = true
+	}
 
-		if _, ok := s.Uris[uri]; ok {
+	for _, folder := range folders {
+		if folder.Cache == nil || folder.removed() {
 			continue
 		}
 
-		logger.GetLogger().Printf("Indexing file: %s", uri)
+		folder.Cache.Retain(found[folder])
+		if err := folder.Cache.Flush(); err != nil {
+			s.Log.Warnf("Error writing index cache: %s", err)
+		}
+	}
 
-		content := scanner.GetFileContent(file)
-		s.Put(uri, content)
+	if replace {
+		s.dropMissing(folders, jobs)
+	}
+}
 
-		update(file, util.CalculatePercentage(i, len(files)))
+// dropMissing removes the indexed files of folders that are not among the
+// files found by the index.
+func (s *Workspace) dropMissing(folders []*Folder, jobs []indexJob) {
+	found := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		found[fileURI(job.folder, job.file)] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for uri := range s.Uris {
+		if found[uri] {
+			continue
+		}
+
+		path := fileuri.ToPath(uri)
+		for _, folder := range folders {
+			if folder.holds(path) {
+				delete(s.Uris, uri)
+				s.Symbols.Remove(uri)
+				s.loaded.forget(uri)
+				s.names.forget(uri)
+				break
+			}
+		}
 	}
 }
 
-func (s *Workspace) Get(uri string) *treesitter.TextDocumentItem {
-	return s.Uris[uri]
+func fileURI(folder *Folder, file string) string {
+	return fileuri.FromPath(filepath.Join(folder.Path, file))
 }
 
-func (s *Workspace) Put(uri string, content string) {
-	s.Uris[uri] = &treesitter.TextDocumentItem{
-		Uri:        uri,
-		LanguageId: "php",
-		Version:    1,
-		Text:       content,
+func (s *Workspace) indexFile(folder *Folder, file string, replace bool) {
+	path := filepath.Join(folder.Path, file)
+	uri := fileURI(folder, file)
+	if !replace && s.indexed(uri) {
+		return
+	}
+
+	logger.Debugf("Indexing file: %s", uri)
+
+	content, symbols, err := s.readFile(folder, path, file)
+	if err != nil {
+		s.Log.Warnf("Error reading file: %s", err)
+		return
 	}
 
-	s.FetchDocumentSymbols(uri, content)
+	if replace {
+		s.put(uri, content, symbols)
+		return
+	}
+
+	s.add(uri, content, symbols)
 }
 
-// @todo implement incremental parsing
-func (s *Workspace) Update(uri string, contentChanges []lsp.TextDocumentContentChangeEvent) {
-	s.Uris[uri].Text = contentChanges[0].Text
+// readFile reads the file at path, file being its path relative to folder,
+// and takes its symbols from the cache of the folder when it has them. The
+// symbols are nil without a cache, they are extracted with the document.
+func (s *Workspace) readFile(folder *Folder, path string, file string) (string, *extracted, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cache := folder.Cache
+	if cache == nil {
+		return string(content), nil, nil
+	}
+
+	// the declarations of every file are cached, as the symbols of library
+	// files and next to the full symbols of the others
+	mode := indexMode(folder, path)
+	hash := cache.Key(file, info, content)
+	symbols, ok := cache.Symbols(hash, mode)
+	declarations, declarationsOk := symbols, ok
+	if mode == treesitter.ModeFull {
+		declarations, declarationsOk = cache.Symbols(hash, treesitter.ModeDeclarations)
+	}
+
+	if !ok || !declarationsOk {
+		symbols, declarations = treesitter.Extract(string(content), mode)
+		if err := cache.StoreSymbols(hash, mode, symbols); err != nil {
+			s.Log.Warnf("Error caching symbols of %s: %s", path, err)
+		}
+		if mode == treesitter.ModeFull {
+			if err := cache.StoreSymbols(hash, treesitter.ModeDeclarations, declarations); err != nil {
+				s.Log.Warnf("Error caching symbols of %s: %s", path, err)
+			}
+		}
+	}
+	cache.Remember(file, info, hash)
+
+	return string(content), &extracted{symbols: symbols, declarations: declarations}, nil
+}
 
-	s.FetchDocumentSymbols(uri, contentChanges[0].Text)
+// progress counts the files indexed by the workers and reports it, at most
+// once per progressInterval.
+type progress struct {
+	mu         sync.Mutex
+	total      int
+	count      int
+	lastReport time.Time
+	update     func(Progress)
 }
 
-func symbolToLspSymbol(symbol *treesitter.Symbol) lsp.DocumentSymbol {
+func newProgress(total int, update func(Progress)) *progress {
+	return &progress{total: total, update: update}
+}
+
+func (p *progress) done(job indexJob) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.count++
+	if time.Since(p.lastReport) < progressInterval && p.count < p.total {
+		return
+	}
+
+	p.lastReport = time.Now()
+	p.update(Progress{Folder: job.folder.Name, File: job.file, Indexed: p.count, Total: p.total})
+}
+
+func symbolToLspSymbol(symbol *treesitter.Symbol, rangeOf func(treesitter.Position) lsp.Range) lsp.DocumentSymbol {
 	childs := []lsp.DocumentSymbol{}
 	for _, child := range symbol.Children {
-		childs = append(childs, symbolToLspSymbol(&child))
+		childs = append(childs, symbolToLspSymbol(&child, rangeOf))
+	}
+
+	// declarations in a namespace show where they belong
+	detail := ""
+	if symbol.FQN != symbol.Name {
+		detail = symbol.FQN
 	}
 
 	return lsp.DocumentSymbol{
-		Name: symbol.Name,
-		Kind: int(symbol.Kind),
-		Range: lsp.Range{
-			Start: lsp.Position{
-				Line:      int(symbol.Position.LineStart),
-				Character: int(symbol.Position.OffsetStart),
-			},
-			End: lsp.Position{
-				Line:      int(symbol.Position.LineEnd),
-				Character: int(symbol.Position.OffsetEnd),
-			},
-		},
-		SelectionRange: lsp.Range{
-			Start: lsp.Position{
-				Line:      int(symbol.Position.LineStart),
-				Character: int(symbol.Position.OffsetStart),
-			},
-			End: lsp.Position{
-				Line:      int(symbol.Position.LineEnd),
-				Character: int(symbol.Position.OffsetEnd),
-			},
-		},
-		Children: childs,
+		Name:           symbol.Name,
+		Detail:         detail,
+		Kind:           int(symbol.Kind),
+		Range:          rangeOf(symbol.Range),
+		SelectionRange: rangeOf(symbol.Position),
+		Children:       childs,
 	}
 }
 
-func (s *Workspace) FetchDocumentSymbols(uri string, text string) {
-	symbols := treesitter.GetDocumentSymbols(text)
+func (s *Workspace) FetchDocumentSymbols(item *treesitter.TextDocumentItem) {
+	var symbols []treesitter.Symbol
+	if item.Tree != nil {
+		symbols = treesitter.GetTreeSymbols(item.Text, item.Tree)
+	} else {
+		symbols = treesitter.GetDocumentSymbols(item.Text)
+	}
+
+	s.setDocumentSymbols(item, symbols)
+}
+
+// rangeOf converts positions of the content indexed by lines to those of the
+// client.
+func (s *Workspace) rangeOf(lines *treesitter.LineIndex) func(treesitter.Position) lsp.Range {
+	return func(position treesitter.Position) lsp.Range {
+		return lsp.Range{
+			Start: lines.Position(sitter.Point{Row: position.LineStart, Column: position.OffsetStart}, s.PositionEncoding),
+			End:   lines.Position(sitter.Point{Row: position.LineEnd, Column: position.OffsetEnd}, s.PositionEncoding),
+		}
+	}
+}
 
+// setDocumentSymbols converts symbols extracted from the content of item to
+// the positions of the client.
+func (s *Workspace) setDocumentSymbols(item *treesitter.TextDocumentItem, symbols []treesitter.Symbol) {
+	// symbol positions are in bytes, the client counts in its own encoding
+	rangeOf := s.rangeOf(item.Lines)
 	items := []lsp.DocumentSymbol{}
 	for _, symbol := range symbols {
-		items = append(items, symbolToLspSymbol(&symbol))
+		items = append(items, symbolToLspSymbol(&symbol, rangeOf))
 	}
 
-	s.Uris[uri].DocumentSymbols = items
+	item.DocumentSymbols = items
 }
 
-func (s *Workspace) TextDocumentDocumentSymbols(id int, uri string) lsp.DocumentSymbolResponse {
+func (s *Workspace) TextDocumentDocumentSymbols(id lsp.ID, uri string) lsp.DocumentSymbolResponse {
+	result := []lsp.DocumentSymbol{}
+	if doc := s.Get(uri); doc != nil {
+		result = s.supportedSymbolKinds(doc.DocumentSymbols)
+	}
+
 	response := lsp.DocumentSymbolResponse{
 		Response: lsp.Response{
 			RPC: "2.0",
 			ID:  id,
 		},
-		Result: s.Uris[uri].DocumentSymbols,
+		Result: result,
 	}
 
 	return response
 }
 
-type wsSymbols []struct {
-	URI    string             `json:"uri"`
-	Symbol lsp.DocumentSymbol `json:"symbol"`
+// supportedSymbolKinds replaces the kinds the client does not know, the
+// stored symbols are shared and left untouched.
+func (s *Workspace) supportedSymbolKinds(symbols []lsp.DocumentSymbol) []lsp.DocumentSymbol {
+	result := make([]lsp.DocumentSymbol, 0, len(symbols))
+	for _, symbol := range symbols {
+		symbol.Kind = s.Capabilities.SymbolKind(symbol.Kind)
+		symbol.Children = s.supportedSymbolKinds(symbol.Children)
+		result = append(result, symbol)
+	}
+
+	return result
 }
 
+// TextDocumentSymbolInformation answers documentSymbol for clients that do
+// not support hierarchical symbols, children are flattened and point to
+// their parent with containerName.
+func (s *Workspace) TextDocumentSymbolInformation(id lsp.ID, uri string) lsp.SymbolInformationResponse {
+	result := []lsp.SymbolInformation{}
+	if doc := s.Get(uri); doc != nil {
+		result = s.flattenSymbols(uri, "", doc.DocumentSymbols, result)
+	}
+
+	return lsp.SymbolInformationResponse{
+		Response: lsp.Response{
+			RPC: "2.0",
+			ID:  id,
+		},
+		Result: result,
+	}
+}
+
+func (s *Workspace) flattenSymbols(uri string, container string, symbols []lsp.DocumentSymbol, result []lsp.SymbolInformation) []lsp.SymbolInformation {
+	for _, symbol := range symbols {
+		result = append(result, lsp.SymbolInformation{
+			Name:          symbol.Name,
+			Kind:          s.Capabilities.SymbolKind(symbol.Kind),
+			Location:      lsp.Location{URI: uri, Range: symbol.Range},
+			ContainerName: container,
+		})
+		// members are contained in the fully qualified name of their class
+		name := symbol.Name
+		if symbol.Detail != "" {
+			name = symbol.Detail
+		}
+		result = s.flattenSymbols(uri, name, symbol.Children, result)
+	}
+
+	return result
+}
+
+// globalSymbols matches the short names of symbols with
 // github.com/sahilm/fuzzy
-func (s wsSymbols) Len() int {
+type globalSymbols []symboltable.Symbol
+
+func (s globalSymbols) Len() int {
 	return len(s)
 }
 
-func (s wsSymbols) String(i int) string {
-	return s[i].Symbol.Name
+func (s globalSymbols) String(i int) string {
+	return s[i].Name
 }
 
-func (s *Workspace) WorkspaceSymbols(id int, query string) lsp.WorkspaceSymbolResponse {
-	symbols := []lsp.WorkSpaceSymbol{}
-
-	urisSymbols := wsSymbols{}
-	for _, item := range s.Uris {
-		for _, symbol := range item.DocumentSymbols {
-			urisSymbols = append(urisSymbols, struct {
-				URI    string             `json:"uri"`
-				Symbol lsp.DocumentSymbol `json:"symbol"`
-			}{
-				URI:    item.Uri,
-				Symbol: symbol,
-			})
+// WorkspaceSymbols finds the classes, functions and constants of the
+// workspace. A query with a namespace separator matches the start of fully
+// qualified names, other queries fuzzy match short names.
+func (s *Workspace) WorkspaceSymbols(ctx context.Context, id lsp.ID, query string) lsp.WorkspaceSymbolResponse {
+	var found []symboltable.Symbol
+	if strings.Contains(query, "\\") {
+		found = s.Symbols.Search(query, 0)
+	} else {
+		candidates := globalSymbols(s.Symbols.All())
+		for _, match := range fuzzy.FindFrom(query, candidates) {
+			if ctx.Err() != nil {
+				break
+			}
+			found = append(found, candidates[match.Index])
 		}
 	}
 
-	for _, r := range fuzzy.FindFrom(query, urisSymbols) {
-		ds := urisSymbols[r.Index]
+	symbols := []lsp.WorkSpaceSymbol{}
+	for _, symbol := range found {
 		symbols = append(symbols, lsp.WorkSpaceSymbol{
-			Name: ds.Symbol.Name,
-			Kind: ds.Symbol.Kind,
+			Name:          symbol.Name,
+			Kind:          s.Capabilities.WorkspaceSymbolKind(int(symbol.Kind)),
+			ContainerName: symbol.Namespace(),
 			Location: lsp.Location{
-				URI: ds.URI,
-				Range: lsp.Range{
-					Start: lsp.Position{
-						Line:      ds.Symbol.Range.Start.Line,
-						Character: ds.Symbol.Range.Start.Character,
-					},
-					End: lsp.Position{
-						Line:      ds.Symbol.Range.End.Line,
-						Character: ds.Symbol.Range.End.Character,
-					},
-				},
+				URI:   symbol.URI,
+				Range: symbol.Range,
 			},
 		})
 	}
@@ -189,22 +514,25 @@ func (s *Workspace) WorkspaceSymbols(id int, query string) lsp.WorkspaceSymbolRe
 	return response
 }
 
-func (s *Workspace) TextDocumentCompletion(id int, textDocumentPosition lsp.TextDocumentPositionParams) lsp.CompletionResponse {
+func (s *Workspace) TextDocumentCompletion(id lsp.ID, textDocumentPosition lsp.TextDocumentPositionParams) lsp.CompletionResponse {
+	doc := s.Document(textDocumentPosition.TextDocument.Uri)
 
-	pos := textDocumentPosition.Position
-	pos.Character = pos.Character - 1
+	completions := []lsp.CompletionItem{}
 
-	doc := s.Get(textDocumentPosition.TextDocument.Uri)
+	var matches []completor.Match
+	if doc != nil {
+		// complete the node of the character right before the cursor
+		offset := doc.Lines.Offset(textDocumentPosition.Position, s.PositionEncoding)
+		_, size := utf8.DecodeLastRuneInString(doc.Text[:offset])
+		point := doc.Lines.PointAt(offset - size)
+		pos := lsp.Position{Line: int(point.Row), Character: int(point.Column)}
 
-	completor := completor.NewCompletor()
-	matches := completor.GetCompletions(doc, pos)
+		completor := completor.NewCompletor(s.Symbols)
+		matches = completor.GetCompletions(doc, pos)
+	}
 
-	completions := []lsp.CompletionItem{}
 	for _, match := range matches {
-		completions = append(completions, lsp.CompletionItem{
-			Label: match.Text,
-			Kind:  match.Kind,
-		})
+		completions = append(completions, s.completionItem(match))
 	}
 
 	response := lsp.CompletionResponse{
@@ -217,3 +545,22 @@ func (s *Workspace) TextDocumentCompletion(id int, textDocumentPosition lsp.Text
 
 	return response
 }
+
+func (s *Workspace) completionItem(match completor.Match) lsp.CompletionItem {
+	item := lsp.CompletionItem{
+		Label: match.Text,
+		Kind:  s.Capabilities.CompletionItemKind(match.Kind),
+	}
+
+	if match.Declaration != "" {
+		item.Documentation = lsp.NewCodeDocumentation(s.Capabilities.DocumentationFormat(), match.Declaration)
+	}
+
+	// place the cursor between the parentheses of a method call
+	if match.Kind == lsp.Symbol_Kind_Method && s.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport {
+		item.InsertText = match.Text + "($0)"
+		item.InsertTextFormat = lsp.InsertTextFormatSnippet
+	}
+
+	return item
+}
@@ -0,0 +1,454 @@
+package workspace_test
+
+import (
+	"ahmedash95/php-lsp-server/pkg/config"
+	"ahmedash95/php-lsp-server/pkg/lsp"
+	"ahmedash95/php-lsp-server/pkg/workspace"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStartIndex(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%d", i%5))
+		os.MkdirAll(dir, 0755)
+
+		content := fmt.Sprintf("<?php\nclass Class%d {}", i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.php", i)), []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing file: %s", err)
+		}
+	}
+
+	tests := map[string]struct {
+		cancelled bool
+		indexed   int
+	}{
+		"indexes every file":   {cancelled: false, indexed: 50},
+		"stops when cancelled": {cancelled: true, indexed: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := workspace.NewWorkspace("")
+			w.Config = config.Config{Indexing: config.Indexing{Workers: 4}}
+			w.AddFolder("root", root, w.Config)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancelled {
+				cancel()
+			}
+			defer cancel()
+
+			percents := []int{}
+			ended := false
+			w.StartIndex(ctx, func(progress workspace.Progress) {
+				percents = append(percents, progress.Percentage())
+			}, func() {
+				ended = true
+			})
+
+			if !ended {
+				t.Errorf("Expected the end of indexing to be reported")
+			}
+
+			for i := 1; i < len(percents); i++ {
+				if percents[i] < percents[i-1] {
+					t.Errorf("Expected progress to only grow, got %v", percents)
+				}
+			}
+
+			if tt.indexed > 0 && (len(percents) == 0 || percents[len(percents)-1] != 100) {
+				t.Errorf("Expected progress to end at 100, got %v", percents)
+			}
+
+			indexed := 0
+			for i := 0; i < 50; i++ {
+				uri := fmt.Sprintf("file://%s/dir%d/file%d.php", root, i%5, i)
+				if doc := w.Get(uri); doc != nil && len(doc.DocumentSymbols) == 1 {
+					indexed++
+				}
+			}
+
+			if indexed != tt.indexed {
+				t.Errorf("Expected %d indexed files, got %d", tt.indexed, indexed)
+			}
+		})
+	}
+}
+
+func TestStartIndexReusesCachedSymbols(t *testing.T) {
+	root := t.TempDir()
+	dir := t.TempDir()
+	path := filepath.Join(root, "a.php")
+	uri := "file://" + root + "/a.php"
+
+	index := func() string {
+		w := workspace.NewWorkspace("")
+		cfg := config.Default()
+		cfg.Cache.Directory = dir
+		if folder := w.AddFolder("root", root, cfg); folder.Cache == nil {
+			t.Fatalf("Expected the cache of the folder to be opened")
+		}
+		w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+		doc := w.Get(uri)
+		if doc == nil || len(doc.DocumentSymbols) != 1 {
+			t.Fatalf("Expected %s to be indexed", uri)
+		}
+
+		return doc.DocumentSymbols[0].Name
+	}
+
+	if err := os.WriteFile(path, []byte("<?php\nclass Foo {}"), 0644); err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+	info, _ := os.Stat(path)
+
+	if name := index(); name != "Foo" {
+		t.Errorf("Expected %v, got %v", "Foo", name)
+	}
+
+	// same size and modification time, the file is not parsed again
+	os.WriteFile(path, []byte("<?php\nclass Bar {}"), 0644)
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+	if name := index(); name != "Foo" {
+		t.Errorf("Expected the cached %v, got %v", "Foo", name)
+	}
+
+	os.Chtimes(path, info.ModTime().Add(time.Second), info.ModTime().Add(time.Second))
+	if name := index(); name != "Bar" {
+		t.Errorf("Expected %v, got %v", "Bar", name)
+	}
+}
+
+func TestCancelledIndexKeepsTheCache(t *testing.T) {
+	root := t.TempDir()
+	dir := t.TempDir()
+	files := 400
+	name := func(prefix string, i int) string { return fmt.Sprintf("%s%03d", prefix, i) }
+	path := func(i int) string { return filepath.Join(root, name("f", i)+".php") }
+	for i := 0; i < files; i++ {
+		writeFile(t, path(i), "<?php\nclass "+name("A", i)+" {}")
+	}
+
+	index := func(cancelled bool) *workspace.Workspace {
+		w := workspace.NewWorkspace("")
+		cfg := config.Default()
+		cfg.Cache.Directory = dir
+		w.AddFolder("root", root, cfg)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w.StartIndex(ctx, func(workspace.Progress) {
+			if cancelled {
+				cancel()
+			}
+		}, func() {})
+
+		return w
+	}
+
+	index(false)
+
+	// same size and modification time, only the cache knows the old content
+	for i := 0; i < files; i++ {
+		info, _ := os.Stat(path(i))
+		writeFile(t, path(i), "<?php\nclass "+name("B", i)+" {}")
+		os.Chtimes(path(i), info.ModTime(), info.ModTime())
+	}
+
+	index(true)
+	w := index(false)
+
+	for i := 0; i < files; i++ {
+		uri := "file://" + path(i)
+		if got := symbolName(w, uri); got != name("A", i) {
+			t.Fatalf("Expected the cached %s for %s, got %s", name("A", i), uri, got)
+		}
+	}
+}
+
+func TestStartIndexOnlyKeepsDeclarationsOfLibraries(t *testing.T) {
+	root := t.TempDir()
+	code := "<?php\nfunction helper() {\n    $local = 1;\n}\n$global = 2;"
+	for _, file := range []string{"app/a.php", "vendor/acme/a.php", "stubs/a.php"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, file)), 0755)
+		if err := os.WriteFile(filepath.Join(root, file), []byte(code), 0644); err != nil {
+			t.Fatalf("Error writing file: %s", err)
+		}
+	}
+
+	w := workspace.NewWorkspace("")
+	cfg := config.Default()
+	cfg.Cache.Enabled = false
+	cfg.Indexing.LibraryPaths = []string{"stubs"}
+	w.AddFolder("root", root, cfg)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	tests := map[string]int{
+		"app/a.php":         2,
+		"vendor/acme/a.php": 1,
+		"stubs/a.php":       1,
+	}
+
+	for file, symbols := range tests {
+		t.Run(file, func(t *testing.T) {
+			doc := w.Get("file://" + root + "/" + file)
+			if doc == nil {
+				t.Fatalf("Expected %s to be indexed", file)
+			}
+
+			if len(doc.DocumentSymbols) != symbols || doc.DocumentSymbols[0].Name != "helper" {
+				t.Errorf("Expected %d symbols starting with helper, got %v", symbols, doc.DocumentSymbols)
+			}
+		})
+	}
+}
+
+func TestStartIndexFollowsScanRules(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":          "vendor/\ncache/\n",
+		"app/a.php":           "<?php",
+		"cache/compiled.php":  "<?php",
+		"node_modules/x.php":  "<?php",
+		"vendor/acme/lib.php": "<?php",
+	}
+	for file, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, file)), 0755)
+		if err := os.WriteFile(filepath.Join(root, file), []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing file: %s", err)
+		}
+	}
+
+	w := workspace.NewWorkspace(root)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	tests := map[string]bool{
+		"app/a.php":           true,
+		"cache/compiled.php":  false,
+		"node_modules/x.php":  false,
+		"vendor/acme/lib.php": true,
+	}
+
+	for file, indexed := range tests {
+		t.Run(file, func(t *testing.T) {
+			if doc := w.Get("file://" + root + "/" + file); (doc != nil) != indexed {
+				t.Errorf("Expected indexed %v, got %v", indexed, doc != nil)
+			}
+		})
+	}
+}
+
+func TestSymbolTableFollowsTheDocuments(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "Admin.php"), "<?php\nnamespace App\\Admin;\nclass User {}")
+	writeFile(t, filepath.Join(root, "User.php"), "<?php\nnamespace App\\Models;\nclass User {}")
+
+	w := workspace.NewWorkspace(root)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	uri := "file://" + root + "/User.php"
+	found := func(fqn string) bool { return len(w.Symbols.Lookup(fqn)) == 1 }
+
+	if !found(`App\Admin\User`) || !found(`App\Models\User`) {
+		t.Fatalf("Expected both User classes to be indexed by their fully qualified names")
+	}
+
+	w.Open(uri, 1, "<?php\nnamespace App\\Models;\nclass Person {}")
+	if found(`App\Models\User`) || !found(`App\Models\Person`) {
+		t.Errorf("Expected the open buffer to replace the symbols of the file")
+	}
+
+	w.Close(uri)
+	if !found(`App\Models\User`) || found(`App\Models\Person`) {
+		t.Errorf("Expected the symbols on disk once the buffer is closed")
+	}
+
+	response := w.WorkspaceSymbols(context.Background(), lsp.ID{}, `App\Models\`)
+	if len(response.Result) != 1 || response.Result[0].ContainerName != `App\Models` {
+		t.Errorf("Expected the User class of App\\Models, got %v", response.Result)
+	}
+
+	os.Remove(filepath.Join(root, "User.php"))
+	w.FilesChanged([]lsp.FileEvent{{Uri: uri, Type: lsp.FileChangeDeleted}})
+	if found(`App\Models\User`) {
+		t.Errorf("Expected the symbols of a deleted file to be removed")
+	}
+}
+
+func TestClosingAFileOutsideTheFoldersDropsIt(t *testing.T) {
+	root := t.TempDir()
+	stray := filepath.Join(t.TempDir(), "Stray.php")
+	writeFile(t, stray, "<?php\nclass Stray {}")
+
+	w := workspace.NewWorkspace(root)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	uri := "file://" + stray
+	w.Open(uri, 1, "<?php\nclass Stray {}")
+	w.Save(uri, nil)
+	w.Close(uri)
+
+	if w.Get(uri) != nil || len(w.Symbols.Lookup("Stray")) != 0 {
+		t.Errorf("Expected the closed file outside the folders to be dropped")
+	}
+}
+
+func TestClosingAnExcludedFileDropsIt(t *testing.T) {
+	root := t.TempDir()
+	ignored := filepath.Join(root, "node_modules", "Ignored.php")
+	writeFile(t, ignored, "<?php\nclass Ignored {}")
+
+	w := workspace.NewWorkspace(root)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	uri := "file://" + ignored
+	w.Open(uri, 1, "<?php\nclass Ignored {}")
+	w.Save(uri, nil)
+	w.Close(uri)
+
+	if w.Get(uri) != nil || len(w.Symbols.Lookup("Ignored")) != 0 {
+		t.Errorf("Expected the closed file the index leaves out to be dropped")
+	}
+}
+
+func TestDocumentSymbolsShowTheirNamespace(t *testing.T) {
+	root := t.TempDir()
+	uri := "file://" + root + "/User.php"
+
+	w := workspace.NewWorkspace(root)
+	w.Open(uri, 1, "<?php\nnamespace App\\Models;\nclass User {\n    public function name() {}\n}")
+
+	symbols := w.TextDocumentDocumentSymbols(lsp.ID{}, uri).Result
+	if len(symbols) != 1 || symbols[0].Name != `App\Models` || len(symbols[0].Children) != 1 {
+		t.Fatalf("Expected the namespace to hold the class, got %v", symbols)
+	}
+	if class := symbols[0].Children[0]; class.Detail != `App\Models\User` || len(class.Children) != 1 {
+		t.Errorf("Expected the class with its fully qualified name and method, got %v", class)
+	}
+
+	containers := map[string]string{}
+	for _, symbol := range w.TextDocumentSymbolInformation(lsp.ID{}, uri).Result {
+		containers[symbol.Name] = symbol.ContainerName
+	}
+	expected := map[string]string{`App\Models`: "", "User": `App\Models`, "name": `App\Models\User`}
+	if !reflect.DeepEqual(containers, expected) {
+		t.Errorf("Expected containers %v, got %v", expected, containers)
+	}
+}
+
+func TestDocumentLoadsIndexedFilesFromDisk(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.php")
+	uri := "file://" + path
+	writeFile(t, path, "<?php\nclass Foo {}")
+
+	w := workspace.NewWorkspace(root)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	if doc := w.Get(uri); doc == nil || doc.Text != "" {
+		t.Fatalf("Expected the index to only keep the symbols of %s", uri)
+	}
+
+	doc := w.Document(uri)
+	if doc == nil || doc.Text != "<?php\nclass Foo {}" || doc.Tree == nil {
+		t.Fatalf("Expected the content and tree of %s, got %v", uri, doc)
+	}
+
+	if w.Document(uri) != doc {
+		t.Errorf("Expected the loaded document to be kept within the budget")
+	}
+
+	w.Config.Memory.Budget = 0
+	writeFile(t, path, "<?php\nclass Bar {}")
+	w.FilesChanged([]lsp.FileEvent{{Uri: uri, Type: lsp.FileChangeChanged}})
+	if doc := w.Document(uri); doc == nil || doc.Text != "<?php\nclass Bar {}" {
+		t.Errorf("Expected the content of the reindexed file, got %v", doc)
+	}
+
+	if w.Document(uri) == w.Document(uri) {
+		t.Errorf("Expected documents over the budget to be read again")
+	}
+
+	w.Open(uri, 1, "<?php\nclass Open {}")
+	if doc := w.Document(uri); doc == nil || doc.Text != "<?php\nclass Open {}" {
+		t.Errorf("Expected the open buffer, got %v", doc)
+	}
+}
+
+func TestReindexReplacesTheIndexedFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "changed.php"), "<?php\nclass Before {}")
+	writeFile(t, filepath.Join(root, "deleted.php"), "<?php\nclass Deleted {}")
+
+	w := workspace.NewWorkspace(root)
+	w.StartIndex(context.Background(), func(workspace.Progress) {}, func() {})
+
+	// changed without the workspace being told
+	writeFile(t, filepath.Join(root, "changed.php"), "<?php\nclass After {}")
+	writeFile(t, filepath.Join(root, "created.php"), "<?php\nclass Created {}")
+	os.Remove(filepath.Join(root, "deleted.php"))
+
+	var last workspace.Progress
+	w.Reindex(context.Background(), w.Folders(), func(progress workspace.Progress) {
+		last = progress
+	}, func() {})
+
+	if last.Indexed != 2 || last.Total != 2 || last.Folder != filepath.Base(root) {
+		t.Errorf("Expected 2 of 2 files of %s indexed, got %+v", filepath.Base(root), last)
+	}
+
+	tests := map[string]string{
+		"changed.php": "After",
+		"created.php": "Created",
+		"deleted.php": "",
+	}
+
+	for file, expected := range tests {
+		t.Run(file, func(t *testing.T) {
+			if name := symbolName(w, "file://"+root+"/"+file); name != expected {
+				t.Errorf("Expected %q, got %q", expected, name)
+			}
+		})
+	}
+}
+
+func TestUpdateOnlyWalksChangedStatements(t *testing.T) {
+	uri := "file:///app/a.php"
+	w := workspace.NewWorkspace("")
+	w.Open(uri, 1, "<?php\nclass Foo {}\n\nfunction helper() {\n    $a = 1;\n}\n")
+
+	w.Update(uri, 2, []lsp.TextDocumentContentChangeEvent{{
+		Range: &lsp.Range{Start: lsp.Position{Line: 4, Character: 11}, End: lsp.Position{Line: 4, Character: 11}},
+		Text:  " $b = 2;",
+	}})
+
+	doc := w.Get(uri)
+	if len(doc.Changed) != 1 || doc.Changed[0].StartPoint.Row != 3 || doc.Changed[0].EndPoint.Row != 5 {
+		t.Errorf("Expected the helper function to be changed, got %v", doc.Changed)
+	}
+
+	names := []string{}
+	for _, symbol := range doc.DocumentSymbols {
+		names = append(names, symbol.Name)
+		for _, child := range symbol.Children {
+			names = append(names, child.Name)
+		}
+	}
+	if expected := []string{"Foo", "helper", "a", "b"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	w.Update(uri, 3, []lsp.TextDocumentContentChangeEvent{{Text: "<?php\nclass Bar {}\n"}})
+	doc = w.Get(uri)
+	if len(doc.Changed) != 1 || doc.Changed[0].EndPoint.Row != 2 || doc.DocumentSymbols[0].Name != "Bar" {
+		t.Errorf("Expected the whole document to be changed, got %v", doc.Changed)
+	}
+}
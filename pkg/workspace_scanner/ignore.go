@@ -0,0 +1,137 @@
+package workspacescanner
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignorePattern is a single line of a .gitignore file or an exclude glob.
+type ignorePattern struct {
+	// base is the directory, relative to the scanned root, the pattern is
+	// relative to, empty for the root itself.
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	// anchored patterns match paths relative to base, the others match
+	// the name of a file or directory at any depth.
+	anchored bool
+}
+
+func parsePattern(base string, line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	p := ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, "\\")
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	p.segments = strings.Split(line, "/")
+	return p, true
+}
+
+// match tells whether the pattern matches rel, a slash separated path
+// relative to the scanned root.
+func (p ignorePattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+
+	if !p.anchored {
+		ok, _ := path.Match(p.segments[0], path.Base(rel))
+		return ok
+	}
+
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments against glob segments, ** matches any
+// number of segments.
+func matchSegments(patterns []string, segments []string) bool {
+	if len(patterns) == 0 {
+		return len(segments) == 0
+	}
+
+	if patterns[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(patterns[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(patterns[0], segments[0]); !ok {
+		return false
+	}
+
+	return matchSegments(patterns[1:], segments[1:])
+}
+
+// ignoreRules are the patterns applying to a directory, those of its parents
+// first so the last matching pattern wins as in git.
+type ignoreRules []ignorePattern
+
+func (r ignoreRules) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range r {
+		if p.match(rel, isDir) {
+			ignored = !p.negate
+		}
+	}
+
+	return ignored
+}
+
+// withGitignore returns the rules extended with the .gitignore of dir, if it
+// has one. base is dir relative to the scanned root.
+func (r ignoreRules) withGitignore(dir string, base string) ignoreRules {
+	file, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return r
+	}
+	defer file.Close()
+
+	rules := append(ignoreRules{}, r...)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := parsePattern(base, scanner.Text()); ok {
+			rules = append(rules, p)
+		}
+	}
+
+	return rules
+}
@@ -1,13 +1,31 @@
 package workspacescanner
 
 import (
+	"ahmedash95/php-lsp-server/pkg/fileuri"
 	"ahmedash95/php-lsp-server/pkg/logger"
+	"context"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type Scanner struct {
 	Path string
+	// Exclude holds gitignore style patterns, relative to Path, of files
+	// and directories to skip.
+	Exclude []string
+	// Include holds directories scanned even when they are excluded or
+	// ignored, they may be outside Path.
+	Include []string
+	// MaxFileSize skips files bigger than it in bytes, zero for no limit.
+	MaxFileSize int64
+	// Gitignore skips files ignored by the .gitignore files of the tree.
+	Gitignore bool
+	// Log receives the errors met while scanning, nil for the default
+	// logger.
+	Log *logger.Logger
 }
 
 func NewScanner(path string) *Scanner {
@@ -20,42 +38,317 @@ func (s *Scanner) GetFileContent(path string) string {
 	absolutepath := filepath.Join(s.Path, path)
 	content, err := os.ReadFile(absolutepath)
 	if err != nil {
-		logger.GetLogger().Printf("Error reading file: %s", err)
+		s.Log.Warnf("Error reading file: %s", err)
 		return ""
 	}
 	return string(content)
 }
 
-func (s *Scanner) Scan(ext []string) []string {
-	files := make([]string, 0)
-	s.walkDir(s.Path, ext, &files)
-	return files
-}
-
-func (s *Scanner) walkDir(dirPath string, ext []string, files *[]string) {
+// Scan returns the files with one of the extensions, relative to Path. Files
+// of included directories outside Path are relative to it too. Symlinks are
+// followed and every file is returned once, relative to its resolved path.
+// Once ctx is done the walk stops, returning the files found so far.
+func (s *Scanner) Scan(ctx context.Context, ext []string) []string {
 	extMap := make(map[string]bool)
 	for _, e := range ext {
 		extMap[e] = true
 	}
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	scan := &scan{
+		ctx:      ctx,
+		root:     fileuri.CanonicalPath(s.Path),
+		ext:      extMap,
+		seen:     make(map[string]bool),
+		dirs:     make(map[string]bool),
+		includes: make(map[string]bool),
+		files:    make([]string, 0),
+	}
+
+	var includes []string
+	for _, include := range s.includes() {
+		if _, err := os.Stat(include); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		include = fileuri.CanonicalPath(include)
+		includes = append(includes, include)
+		scan.includes[include] = true
+	}
+
+	s.walkDir(scan, scan.root, "", s.excludeRules())
+
+	for _, include := range includes {
+		if ctx.Err() != nil {
+			break
+		}
+		s.walkDir(scan, include, "", nil)
+	}
+
+	return scan.files
+}
+
+// scan holds the state of a Scan across the directories it walks.
+type scan struct {
+	ctx context.Context
+	// root is Path with symlinks resolved, files are relative to it.
+	root string
+	ext  map[string]bool
+	// seen holds the files found, dirs the directories walked, both with
+	// symlinks resolved.
+	seen map[string]bool
+	dirs map[string]bool
+	// includes holds the included directories, with symlinks resolved.
+	// Other walks leave them to their own, which finds every file theirs
+	// would as it skips none of the excluded ones, so they are read once.
+	includes map[string]bool
+	files    []string
+}
+
+// Includes tells whether Scan would return the file at path, an absolute
+// path, without walking the whole tree.
+func (s *Scanner) Includes(path string, ext []string) bool {
+	matches := false
+	for _, e := range ext {
+		matches = matches || filepath.Ext(path) == e
+	}
+	if !matches {
+		return false
+	}
+
+	included := false
+	for _, include := range s.includes() {
+		if within(include, path) && s.allowed(include, path, nil) {
+			included = true
+			break
+		}
+	}
+
+	if !included && !(within(s.Path, path) && s.allowed(s.Path, path, s.excludeRules())) {
+		return false
+	}
+
+	if s.MaxFileSize > 0 {
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > s.MaxFileSize {
+			return false
+		}
+	}
+
+	return true
+}
+
+// allowed checks path and each of its parents below root against the rules.
+func (s *Scanner) allowed(root string, path string, rules ignoreRules) bool {
+	_, ok := s.rulesAt(root, path, false, rules)
+	return ok
+}
+
+// rulesAt checks path and each of its parents below root against the rules,
+// like allowed, and returns the rules applying in path's directory, those of
+// the .gitignore files of its parents added.
+func (s *Scanner) rulesAt(root string, path string, isDir bool, rules ignoreRules) (ignoreRules, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, false
+	}
+	if rel == "." {
+		return rules, true
+	}
+
+	if s.Gitignore {
+		rules = rules.withGitignore(root, "")
+	}
+
+	dir := root
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		current := strings.Join(parts[:i+1], "/")
+		last := i == len(parts)-1
+		if rules.ignored(current, isDir || !last) {
+			return nil, false
+		}
+
+		if !last && s.Gitignore {
+			dir = filepath.Join(dir, part)
+			rules = rules.withGitignore(dir, current)
+		}
+	}
+
+	return rules, true
+}
+
+func (s *Scanner) excludeRules() ignoreRules {
+	var rules ignoreRules
+	for _, pattern := range s.Exclude {
+		if p, ok := parsePattern("", pattern); ok {
+			rules = append(rules, p)
+		}
+	}
+
+	return rules
+}
+
+// includes returns the absolute paths of the included directories.
+func (s *Scanner) includes() []string {
+	includes := make([]string, 0, len(s.Include))
+	for _, include := range s.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(s.Path, include)
+		}
+		includes = append(includes, filepath.Clean(include))
+	}
+
+	return includes
+}
+
+// within tells whether path is inside dir.
+func within(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// walkDir collects the files below root, a path with symlinks resolved.
+// The rules match paths relative to root prefixed with base, the path root
+// is walked as. Unreadable directories are logged and skipped rather than
+// aborting the walk.
+//
+// Symlinked directories inside the scanned root are walked with the rules of
+// their target, so a link cannot bring back an excluded tree. Those outside
+// of it are walked as if they were at the path of the link.
+func (s *Scanner) walkDir(scan *scan, root string, base string, rules ignoreRules) {
+	if scan.dirs[root] {
+		return
+	}
+	scan.dirs[root] = true
+
+	// rules of every directory walked so far, keyed by their path
+	dirRules := make(map[string]ignoreRules)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if scan.ctx.Err() != nil {
+			return scan.ctx.Err()
+		}
+
 		if err != nil {
-			return err // propagate the error further (e.g., permissions error)
-		}
-		if !info.IsDir() {
-			if extMap[filepath.Ext(info.Name())] {
-				relativePath, err := filepath.Rel(s.Path, path)
-				if err != nil {
-					logger.GetLogger().Printf("Error getting relative path: %s", err)
-				} else {
-					*files = append(*files, relativePath)
+			s.Log.Warnf("Error walking %s: %s", path, err)
+			if d != nil && d.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			s.Log.Warnf("Error getting relative path: %s", err)
+			return nil
+		}
+		rel = joinRel(base, filepath.ToSlash(rel))
+
+		parentRules := rules
+		if path != root {
+			parentRules = dirRules[filepath.Dir(path)]
+			if parentRules.ignored(rel, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if d.IsDir() {
+			if path != root && scan.includes[path] {
+				return filepath.SkipDir
+			}
+			if s.Gitignore {
+				parentRules = parentRules.withGitignore(path, rel)
+			}
+			dirRules[path] = parentRules
+			return nil
+		}
+
+		info := d.Info
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				s.Log.Warnf("Error resolving symlink %s: %s", path, err)
+				return nil
+			}
+
+			stat, err := os.Stat(target)
+			if err != nil {
+				s.Log.Warnf("Error reading %s: %s", target, err)
+				return nil
+			}
+
+			if stat.IsDir() {
+				if parentRules.ignored(rel, true) {
+					return nil
 				}
+
+				if within(scan.root, target) {
+					targetRel, err := filepath.Rel(scan.root, target)
+					if err != nil {
+						s.Log.Warnf("Error getting relative path: %s", err)
+						return nil
+					}
+					if targetRules, ok := s.rulesAt(scan.root, target, true, s.excludeRules()); ok {
+						s.walkDir(scan, target, filepath.ToSlash(targetRel), targetRules)
+					}
+					return nil
+				}
+
+				s.walkDir(scan, target, rel, parentRules)
+				return nil
+			}
+
+			path = target
+			info = func() (fs.FileInfo, error) { return stat, nil }
+		}
+
+		if !scan.ext[filepath.Ext(d.Name())] {
+			return nil
+		}
+
+		if s.MaxFileSize > 0 {
+			info, err := info()
+			if err != nil {
+				s.Log.Warnf("Error reading %s: %s", path, err)
+				return nil
+			}
+			if info.Size() > s.MaxFileSize {
+				logger.Infof("Skipping %s, it is bigger than %d bytes", path, s.MaxFileSize)
+				return nil
 			}
 		}
+
+		if scan.seen[path] {
+			return nil
+		}
+		scan.seen[path] = true
+
+		relativePath, err := filepath.Rel(scan.root, path)
+		if err != nil {
+			s.Log.Warnf("Error getting relative path: %s", err)
+			return nil
+		}
+		scan.files = append(scan.files, relativePath)
+
 		return nil
 	})
 
-	if err != nil {
-		logger.GetLogger().Printf("Error walking directory: %s", err)
+	if err != nil && scan.ctx.Err() == nil {
+		s.Log.Warnf("Error walking directory: %s", err)
+	}
+}
+
+// joinRel joins a slash separated path relative to base to it, both relative
+// to the scanned root which is the empty path.
+func joinRel(base string, rel string) string {
+	if rel == "." || rel == "" {
+		return base
+	}
+	if base == "" {
+		return rel
 	}
+
+	return base + "/" + rel
 }
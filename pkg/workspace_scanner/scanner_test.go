@@ -2,15 +2,17 @@ package workspacescanner_test
 
 import (
 	workspacescanner "ahmedash95/php-lsp-server/pkg/workspace_scanner"
+	"context"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 )
 
 func TestNewScanner(t *testing.T) {
-	gp := os.Getenv("GOPATH")
-	path := path.Join(gp, "src/ahmedash95/php-lsp-server")
+	path := "../.."
 
 	tests := map[string]struct {
 		path     string
@@ -60,7 +62,7 @@ func TestNewScanner(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			s := workspacescanner.NewScanner(tt.path)
-			files := s.Scan(tt.ext)
+			files := s.Scan(context.Background(), tt.ext)
 
 			if len(files) != len(tt.expected) {
 				t.Errorf("Expected %d files, got %d", len(tt.expected), len(files))
@@ -74,3 +76,272 @@ func TestNewScanner(t *testing.T) {
 		})
 	}
 }
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanRules(t *testing.T) {
+	files := map[string]string{
+		".gitignore":                 "/build/\n*.generated.php\n!keep.generated.php\n",
+		"index.php":                  "<?php",
+		"keep.generated.php":         "<?php",
+		"model.generated.php":        "<?php",
+		"build/output.php":           "<?php",
+		"node_modules/pkg/index.php": "<?php",
+		"src/.gitignore":             "local/\n",
+		"src/App.php":                "<?php",
+		"src/local/Debug.php":        "<?php",
+		"src/big.php":                "<?php // a file over the size limit",
+		"lib/local/Kept.php":         "<?php",
+		"storage/views/view.php":     "<?php",
+		"tests/storage/Test.php":     "<?php",
+	}
+
+	tests := map[string]struct {
+		scanner  workspacescanner.Scanner
+		expected []string
+	}{
+		"Without rules every file is returned": {
+			workspacescanner.Scanner{},
+			[]string{
+				"build/output.php",
+				"index.php",
+				"keep.generated.php",
+				"lib/local/Kept.php",
+				"model.generated.php",
+				"node_modules/pkg/index.php",
+				"src/App.php",
+				"src/big.php",
+				"src/local/Debug.php",
+				"storage/views/view.php",
+				"tests/storage/Test.php",
+			},
+		},
+		"Nested gitignore files only apply to their directory": {
+			workspacescanner.Scanner{Gitignore: true},
+			[]string{
+				"index.php",
+				"keep.generated.php",
+				"lib/local/Kept.php",
+				"node_modules/pkg/index.php",
+				"src/App.php",
+				"src/big.php",
+				"storage/views/view.php",
+				"tests/storage/Test.php",
+			},
+		},
+		"Exclude globs skip names at any depth unless anchored": {
+			workspacescanner.Scanner{Exclude: []string{"node_modules", "/storage", "**/local/*.php"}},
+			[]string{
+				"build/output.php",
+				"index.php",
+				"keep.generated.php",
+				"model.generated.php",
+				"src/App.php",
+				"src/big.php",
+				"tests/storage/Test.php",
+			},
+		},
+		"Included directories are only walked on their own, without the exclude globs": {
+			workspacescanner.Scanner{Exclude: []string{"**/local/*.php"}, Include: []string{"src"}},
+			[]string{
+				"build/output.php",
+				"index.php",
+				"keep.generated.php",
+				"model.generated.php",
+				"node_modules/pkg/index.php",
+				"storage/views/view.php",
+				"tests/storage/Test.php",
+				"src/App.php",
+				"src/big.php",
+				"src/local/Debug.php",
+			},
+		},
+		"Files above the size limit are skipped": {
+			workspacescanner.Scanner{Exclude: []string{"/build", "/node_modules", "/storage", "/tests", "/lib"}, MaxFileSize: 10},
+			[]string{
+				"index.php",
+				"keep.generated.php",
+				"model.generated.php",
+				"src/App.php",
+				"src/local/Debug.php",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, files)
+
+			tt.scanner.Path = root
+			got := tt.scanner.Scan(context.Background(), []string{".php"})
+
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestScanIncludesPathsOutsideTheRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"project/.gitignore":         "vendor/\n",
+		"project/index.php":          "<?php",
+		"project/vendor/lib/Lib.php": "<?php",
+		"shared/Helper.php":          "<?php",
+	})
+
+	scanner := workspacescanner.Scanner{
+		Path:      filepath.Join(dir, "project"),
+		Gitignore: true,
+		Include:   []string{"vendor", filepath.Join(dir, "shared")},
+	}
+	got := scanner.Scan(context.Background(), []string{".php"})
+
+	expected := []string{
+		"index.php",
+		"vendor/lib/Lib.php",
+		filepath.Join("..", "shared", "Helper.php"),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestScanFollowsSymlinksOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"project/index.php":              "<?php",
+		"project/packages/acme/Acme.php": "<?php",
+		"shared/Helper.php":              "<?php",
+	})
+
+	links := map[string]string{
+		// a composer path repository
+		"project/vendor/acme": "../packages/acme",
+		"project/shared":      "../shared",
+		"project/alias.php":   "index.php",
+		"project/loop":        ".",
+	}
+	for link, target := range links {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, link)), 0755)
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("Symlinks are not supported: %s", err)
+		}
+	}
+
+	scanner := workspacescanner.Scanner{Path: filepath.Join(dir, "project")}
+	got := scanner.Scan(context.Background(), []string{".php"})
+	sort.Strings(got)
+
+	expected := []string{
+		filepath.Join("..", "shared", "Helper.php"),
+		"index.php",
+		filepath.Join("packages", "acme", "Acme.php"),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestScanAppliesTheRulesToSymlinkTargets(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"project/.gitignore":                   "/cache/\n",
+		"project/index.php":                    "<?php",
+		"project/storage/app/public/Cache.php": "<?php",
+		"project/cache/views/View.php":         "<?php",
+		"project/app/Models/User.php":          "<?php",
+		"shared/Helper.php":                    "<?php",
+		"shared/tmp/Tmp.php":                   "<?php",
+	})
+
+	links := map[string]string{
+		// the link of php artisan storage:link
+		"project/public/storage": "../storage/app/public",
+		"project/public/views":   "../cache/views",
+		"project/public/models":  "../app/Models",
+		"project/shared":         "../shared",
+	}
+	for link, target := range links {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, link)), 0755)
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("Symlinks are not supported: %s", err)
+		}
+	}
+
+	scanner := workspacescanner.Scanner{
+		Path:      filepath.Join(dir, "project"),
+		Exclude:   []string{"/storage", "/shared/tmp"},
+		Gitignore: true,
+	}
+	got := scanner.Scan(context.Background(), []string{".php"})
+	sort.Strings(got)
+
+	expected := []string{
+		filepath.Join("..", "shared", "Helper.php"),
+		filepath.Join("app", "Models", "User.php"),
+		"index.php",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestScanStopsOnceTheContextIsDone(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"project/index.php": "<?php",
+		"shared/Helper.php": "<?php",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	scanner := workspacescanner.Scanner{
+		Path:    filepath.Join(dir, "project"),
+		Include: []string{filepath.Join(dir, "shared")},
+	}
+	if got := scanner.Scan(ctx, []string{".php"}); len(got) != 0 {
+		t.Errorf("Expected no files, got %v", got)
+	}
+}
+
+func TestScanSkipsUnreadableDirectories(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a/file.php":      "<?php",
+		"private/key.php": "<?php",
+		"z/file.php":      "<?php",
+	})
+
+	private := filepath.Join(root, "private")
+	if err := os.Chmod(private, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(private, 0755)
+
+	got := workspacescanner.NewScanner(root).Scan(context.Background(), []string{".php"})
+
+	expected := []string{"a/file.php", "z/file.php"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,3 @@
+<?php
+
+function app_helper() {}
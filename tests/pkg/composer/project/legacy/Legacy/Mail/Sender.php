@@ -0,0 +1,3 @@
+<?php
+
+class Legacy_Mail_Sender {}
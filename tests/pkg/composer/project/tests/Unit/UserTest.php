@@ -0,0 +1,5 @@
+<?php
+
+namespace Tests\Unit;
+
+class UserTest {}